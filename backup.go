@@ -0,0 +1,363 @@
+package keva
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const backupManifestName = "keva-backup.json"
+
+// backupSnapshotPrefix begins the names of the temporary snapshots which
+// backups are taken from, inside the store's directory.
+const backupSnapshotPrefix = ".backup-"
+
+// ErrBackupVerificationFailed indicates that restored bucket files did not
+// match the checksums recorded in a backup's manifest.
+var ErrBackupVerificationFailed = errors.New("backup verification failed")
+
+// BackupManifest records every bucket file in a store at the time of a backup,
+// keyed by slash-separated path relative to the store root, along with the
+// hex encoded SHA-256 checksum of each file's contents.
+type BackupManifest struct {
+	Buckets map[string]string `json:"buckets"`
+}
+
+// Backup writes a tar stream to w containing the store's manifest and the
+// bucket files of s which have changed since the backup described by since.
+// Pass an empty manifest to take a full backup. The returned manifest
+// describes the whole store and should be passed to the next incremental
+// backup.
+//
+// The backup is taken from a temporary snapshot inside the store's directory,
+// so bucket saves are held off only while the snapshot is made and not while
+// the stream is written. A snapshot left behind by a crash is removed when the
+// store is next opened with NewStore. Stores opened with OpenReadOnly are
+// backed up directly without a snapshot.
+func Backup(s *Store, w io.Writer, since BackupManifest) (BackupManifest, error) {
+	var snapshotPath string
+
+	if s.readOnly {
+		err := s.beginOperation()
+		if err != nil {
+			return BackupManifest{}, err
+		}
+		defer s.endOperation()
+
+		snapshotPath = s.rootPath
+	} else {
+		var err error
+		snapshotPath, err = takeBackupSnapshot(s)
+		if err != nil {
+			return BackupManifest{}, err
+		}
+		defer s.storage.RemoveAll(snapshotPath)
+	}
+
+	manifest := BackupManifest{Buckets: make(map[string]string)}
+
+	err := walkBucketFiles(s.storage, snapshotPath, func(absFilePath string) error {
+		checksum, err := fileChecksum(s.storage, absFilePath)
+		if err != nil {
+			return err
+		}
+
+		manifest.Buckets[relativeBackupPath(snapshotPath, absFilePath)] = checksum
+		return nil
+	})
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	tw := tar.NewWriter(w)
+
+	encodedManifest, err := json.Marshal(manifest)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	err = writeTarEntry(tw, backupManifestName, int64(len(encodedManifest)), bytes.NewReader(encodedManifest))
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	var paths []string
+	for path := range manifest.Buckets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	err = writeTarFile(s.storage, tw, manifestFileName, filepath.Join(snapshotPath, manifestFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return BackupManifest{}, err
+	}
+
+	for _, path := range paths {
+		if since.Buckets[path] == manifest.Buckets[path] {
+			continue
+		}
+
+		err = writeTarFile(s.storage, tw, path, filepath.Join(snapshotPath, filepath.FromSlash(path)))
+		if err != nil {
+			return BackupManifest{}, err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// Restore applies a backup written by Backup to the store at rootPath, which
+// must not be open. A chain of backups is restored by applying the full
+// backup followed by each incremental backup in order. The store's manifest
+// is included in every backup and is replaced by the restored one.
+//
+// Bucket files not listed in the backup's manifest are removed, and every
+// listed file is verified against its checksum. ErrBackupVerificationFailed
+// is returned if any file is missing or does not match, such as when an
+// incremental backup is applied out of order.
+func Restore(r io.Reader, rootPath string) (BackupManifest, error) {
+	var manifest BackupManifest
+
+	tr := tar.NewReader(r)
+
+	header, err := tr.Next()
+	if err != nil {
+		return manifest, err
+	}
+	if header.Name != backupManifestName {
+		return manifest, fmt.Errorf("expected backup manifest but found '%s'", header.Name)
+	}
+
+	err = json.NewDecoder(tr).Decode(&manifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	storage := newBucketStorage(rootPath, newOptions(nil))
+
+	err = storage.MkdirAll(rootPath)
+	if err != nil {
+		return manifest, err
+	}
+
+	// Any key index no longer matches the buckets, and is rebuilt when the
+	// store is next opened.
+
+	err = storage.RemoveAll(filepath.Join(rootPath, keyIndexDirName))
+	if err != nil {
+		return manifest, err
+	}
+
+	for {
+		header, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+
+		if header.Name == manifestFileName {
+			var storeManifest storeManifest
+
+			err = json.NewDecoder(tr).Decode(&storeManifest)
+			if err == nil {
+				err = storeManifest.Validate()
+			}
+			if err == nil {
+				err = storeManifest.Save(storage)
+			}
+			if err != nil {
+				return manifest, err
+			}
+
+			continue
+		}
+
+		if _, ok := manifest.Buckets[header.Name]; !ok {
+			return manifest, fmt.Errorf("backup contains unexpected file '%s'", header.Name)
+		}
+
+		err = restoreFile(storage, tr, header.Name)
+		if err != nil {
+			return manifest, err
+		}
+	}
+
+	err = walkBucketFiles(storage, rootPath, func(absFilePath string) error {
+		if _, ok := manifest.Buckets[relativeBackupPath(rootPath, absFilePath)]; ok {
+			return nil
+		}
+		return storage.Remove(absFilePath)
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	for path, checksum := range manifest.Buckets {
+		actualChecksum, err := fileChecksum(storage, filepath.Join(rootPath, filepath.FromSlash(path)))
+		if os.IsNotExist(err) || err == nil && actualChecksum != checksum {
+			return manifest, ErrBackupVerificationFailed
+		}
+		if err != nil {
+			return manifest, err
+		}
+	}
+
+	return manifest, nil
+}
+
+func fileChecksum(storage *bucketStorage, absFilePath string) (string, error) {
+	file, err := storage.Open(absFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func relativeBackupPath(rootPath, absFilePath string) string {
+	relPath, _ := filepath.Rel(rootPath, absFilePath)
+	return filepath.ToSlash(relPath)
+}
+
+// removeBackupSnapshots removes any temporary snapshots left in the store at
+// rootPath by backups which were interrupted by a crash.
+func removeBackupSnapshots(storage *bucketStorage, rootPath string) error {
+	entries, err := storage.ReadDir(rootPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), backupSnapshotPrefix) {
+			err = storage.RemoveAll(filepath.Join(rootPath, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func restoreFile(storage *bucketStorage, r io.Reader, path string) error {
+	absFilePath := storage.rootPath
+
+	for _, segment := range strings.Split(path, "/") {
+		if !isBucketName(segment) {
+			return fmt.Errorf("backup contains invalid path '%s'", path)
+		}
+
+		// Buckets may have been split into directories, or directories
+		// collapsed into buckets, since the previous backup was restored.
+
+		fileInfo, err := storage.Stat(absFilePath)
+		if err == nil && !fileInfo.IsDir() {
+			err = storage.Remove(absFilePath)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		err = storage.MkdirAll(absFilePath)
+		if err != nil {
+			return err
+		}
+
+		absFilePath = filepath.Join(absFilePath, segment)
+	}
+
+	err := storage.RemoveAll(absFilePath)
+	if err != nil {
+		return err
+	}
+
+	file, err := storage.CreateFile(absFilePath + ".swp")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return storage.Rename(absFilePath+".swp", absFilePath)
+}
+
+func takeBackupSnapshot(s *Store) (string, error) {
+	snapshotPath, err := s.storage.MkdirTemp(s.rootPath, backupSnapshotPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.Snapshot(snapshotPath)
+	if err != nil {
+		s.storage.RemoveAll(snapshotPath)
+		return "", err
+	}
+
+	return snapshotPath, nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+func writeTarFile(storage *bucketStorage, tw *tar.Writer, name, absFilePath string) error {
+	file, err := storage.Open(absFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return writeTarEntry(tw, name, fileInfo.Size(), file)
+}
@@ -0,0 +1,154 @@
+package keva
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+
+	t.Run("Restore() applies a chain of full and incremental backups", func(t *testing.T) {
+		tempPath := newTempDir(t)
+		defer os.RemoveAll(tempPath)
+
+		s, err := NewStore(filepath.Join(tempPath, "store"))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		s.SetMaxObjectsPerBucket(8)
+
+		for i := 0; i < 50; i++ {
+			s.Put(fmt.Sprintf("key%d", i), i)
+		}
+
+		var full bytes.Buffer
+		manifest, err := Backup(s, &full, BackupManifest{})
+		if err != nil {
+			t.Fatalf("Error taking full backup: %v", err)
+		}
+
+		s.Put("key3", "changed")
+		s.Remove("key4")
+		for i := 50; i < 200; i++ {
+			s.Put(fmt.Sprintf("key%d", i), i)
+		}
+
+		var incremental bytes.Buffer
+		_, err = Backup(s, &incremental, manifest)
+		if err != nil {
+			t.Fatalf("Error taking incremental backup: %v", err)
+		}
+
+		restorePath := filepath.Join(tempPath, "restored")
+
+		_, err = Restore(&full, restorePath)
+		if err != nil {
+			t.Fatalf("Error restoring full backup: %v", err)
+		}
+		_, err = Restore(&incremental, restorePath)
+		if err != nil {
+			t.Fatalf("Error restoring incremental backup: %v", err)
+		}
+
+		restored, err := NewStore(restorePath)
+		if err != nil {
+			t.Fatalf("Could not open restored store: %v", err)
+		}
+
+		keys, err := Diff(s, restored)
+		if err != nil {
+			t.Fatalf("Error comparing stores: %v", err)
+		}
+		if len(keys) != 0 {
+			t.Errorf("Expected restored store to match original but keys differ: %v", keys)
+		}
+	})
+
+	t.Run("Restore() fails verification when an incremental backup is applied out of order", func(t *testing.T) {
+		tempPath := newTempDir(t)
+		defer os.RemoveAll(tempPath)
+
+		s, err := NewStore(filepath.Join(tempPath, "store"))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		s.Put("a", 1)
+		s.Put("b", 2)
+
+		manifest, err := Backup(s, ioutil.Discard, BackupManifest{})
+		if err != nil {
+			t.Fatalf("Error taking full backup: %v", err)
+		}
+
+		s.Put("a", 3)
+
+		var incremental bytes.Buffer
+		_, err = Backup(s, &incremental, manifest)
+		if err != nil {
+			t.Fatalf("Error taking incremental backup: %v", err)
+		}
+
+		s.Put("b", 4)
+		s.Put("c", 5)
+
+		var other bytes.Buffer
+		_, err = Backup(s, &other, BackupManifest{})
+		if err != nil {
+			t.Fatalf("Error taking full backup: %v", err)
+		}
+
+		restorePath := filepath.Join(tempPath, "restored")
+
+		_, err = Restore(&other, restorePath)
+		if err != nil {
+			t.Fatalf("Error restoring full backup: %v", err)
+		}
+
+		_, err = Restore(&incremental, restorePath)
+		if err != ErrBackupVerificationFailed {
+			t.Errorf("Expected ErrBackupVerificationFailed but got %v", err)
+		}
+	})
+
+	t.Run("NewStore() removes snapshots left by interrupted backups", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		s.Put("a", 1)
+
+		snapshotPath, err := takeBackupSnapshot(s)
+		if err != nil {
+			t.Fatalf("Error taking snapshot: %v", err)
+		}
+		s.Close()
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		_, err = os.Stat(snapshotPath)
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected snapshot to have been removed but got %v", err)
+		}
+
+		var value int
+
+		err = s.Get("a", &value)
+		if err != nil {
+			t.Fatalf("Error when retrieving value: %v", err)
+		}
+	})
+}
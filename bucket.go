@@ -5,149 +5,234 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 // ErrValueNotFound indicates that a corresponding value was not found for a key.
 var ErrValueNotFound = errors.New("value not found")
 
+// bucket holds the objects whose IDs share a path. Buckets are only read and
+// modified while holding the lock for their partition, but may be saved from
+// the cache concurrently, so lock guards modification against saving.
 type bucket struct {
+	lock      sync.Mutex
 	id        string
 	path      bucketPath
 	needsSave bool
 	objects   map[string][]byte
+	size      int64
+	fileInfo  os.FileInfo
 }
 
-func (b *bucket) Get(key string, dest interface{}) error {
+func (b *bucket) Get(key string, dest interface{}, codec Codec) error {
 	encodedValue, ok := b.objects[key]
 	if !ok {
 		return ErrValueNotFound
 	}
 
-	return json.Unmarshal(encodedValue, &dest)
+	return codec.Unmarshal(encodedValue, dest)
 }
 
-func (b *bucket) Load(rootPath, id string) error {
+func (b *bucket) Load(storage *bucketStorage, id string) error {
 	b.id = id
 	b.objects = nil
 
 	var err error
-	b.path, err = b.availablePath(rootPath)
+	b.path, err = b.availablePath(storage)
 	if err != nil {
 		return err
 	}
 
-	absFilePath := filepath.Join(rootPath, b.path.PathString())
+	b.objects, b.fileInfo, err = readObjects(storage, storage.AbsPath(b.path))
+	b.size = objectsSize(b.objects)
+	return err
+}
 
-	file, err := os.Open(absFilePath)
+// IsStale indicates whether the bucket's file has been replaced, removed or
+// split by another process since the bucket was loaded.
+func (b *bucket) IsStale(storage *bucketStorage) (bool, error) {
+	path, err := b.availablePath(storage)
 	if err != nil {
-		if os.IsNotExist(err) {
-			b.objects = make(map[string][]byte)
-			return nil
-		}
-		return err
+		return false, err
+	}
+	if path != b.path {
+		return true, nil
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	return decoder.Decode(&b.objects)
+	fileInfo, err := storage.Stat(storage.AbsPath(b.path))
+	if os.IsNotExist(err) {
+		return b.fileInfo != nil, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return b.fileInfo == nil ||
+		!os.SameFile(fileInfo, b.fileInfo) ||
+		!fileInfo.ModTime().Equal(b.fileInfo.ModTime()) ||
+		fileInfo.Size() != b.fileInfo.Size(), nil
 }
 
 func (b *bucket) ObjectCount() int {
 	return len(b.objects)
 }
 
-func (b *bucket) Put(key string, value interface{}) error {
-	encodedValue, err := json.Marshal(value)
+func (b *bucket) Put(key string, value interface{}, codec Codec) error {
+	encodedValue, err := codec.Marshal(value)
 	if err != nil {
 		return err
 	}
 
+	b.PutEncoded(key, encodedValue)
+	return nil
+}
+
+func (b *bucket) PutEncoded(key string, encodedValue []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if oldValue, ok := b.objects[key]; ok {
+		b.size -= int64(len(key) + len(oldValue))
+	}
+
 	b.objects[key] = encodedValue
+	b.size += int64(len(key) + len(encodedValue))
 	b.needsSave = true
-	return nil
 }
 
 func (b *bucket) Remove(key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if oldValue, ok := b.objects[key]; ok {
+		b.size -= int64(len(key) + len(oldValue))
+	}
+
 	delete(b.objects, key)
 	b.needsSave = true
 }
 
-func (b *bucket) Save(rootPath string) error {
+// Save writes the bucket's objects to its file if they have changed, or
+// removes the file if the bucket is empty.
+func (b *bucket) Save(storage *bucketStorage) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
 	if !b.needsSave {
 		return nil
 	}
 
-	absFilePath := filepath.Join(rootPath, b.path.PathString())
+	storage.saving.RLock()
+	defer storage.saving.RUnlock()
 
-	file, err := os.Create(absFilePath + ".swp")
+	err := storage.BeforeSave()
 	if err != nil {
 		return err
 	}
 
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(b.objects)
+	absFilePath := storage.AbsPath(b.path)
+
+	if len(b.objects) == 0 {
+		err = storage.Remove(absFilePath)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = saveObjects(storage, absFilePath, b.objects)
+	}
 	if err != nil {
-		file.Close()
 		return err
 	}
 
-	err = file.Sync()
+	b.needsSave = false
+	return nil
+}
+
+// Size returns the total size of the bucket's keys and encoded values.
+func (b *bucket) Size() int64 {
+	return b.size
+}
+
+// Split replaces the bucket's file with a directory of child buckets, one for
+// each next path segment of the IDs of its objects.
+//
+// The children are written to a temporary directory alongside the bucket's
+// file, which then replaces it. If a crash interrupts the split after the
+// bucket's file has been removed, recoverLayout completes it when the store
+// is next opened.
+//
+// With SyncDirectories, the children and the temporary directory are synced
+// before the bucket's file is removed, and the parent directory is synced
+// after the temporary directory is renamed, so a split which has returned is
+// durable.
+func (b *bucket) Split(storage *bucketStorage, bucketIDForKey func(string) string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	storage.saving.RLock()
+	defer storage.saving.RUnlock()
+
+	err := storage.BeforeSave()
 	if err != nil {
-		file.Close()
 		return err
 	}
 
-	err = file.Close()
-	if err != nil {
-		return err
+	absFilePath := storage.AbsPath(b.path)
+	absTempPath := absFilePath + splitSuffix
+
+	children := make(map[string]map[string][]byte)
+
+	for key, encodedValue := range b.objects {
+		step, _ := bucketPath(bucketIDForKey(key)[len(b.path):]).Step(storage.segmentLength)
+
+		if children[step] == nil {
+			children[step] = make(map[string][]byte)
+		}
+		children[step][key] = encodedValue
 	}
 
-	err = os.Rename(absFilePath+".swp", absFilePath)
+	err = storage.RemoveAll(absTempPath)
 	if err != nil {
 		return err
 	}
 
-	b.needsSave = false
-	return nil
-}
-
-func (b *bucket) Split(rootPath string, bucketForKey func (string) (*bucket, error)) error {
-	absFilePath := filepath.Join(rootPath, b.path.PathString())
-
-	os.Rename(absFilePath, absFilePath+".swp")
-
-	err := os.Mkdir(absFilePath, os.FileMode(0700))
+	err = storage.Mkdir(absTempPath)
 	if err != nil {
-		os.Rename(absFilePath+".swp", absFilePath)
 		return err
 	}
 
-	for key, encodedValue := range b.objects {
-		bucket, err := bucketForKey(key)
+	for step, objects := range children {
+		err = saveObjects(storage, filepath.Join(absTempPath, step), objects)
 		if err != nil {
-			os.RemoveAll(absFilePath)
-			os.Rename(absFilePath+".swp", absFilePath)
+			storage.RemoveAll(absTempPath)
 			return err
 		}
+	}
+
+	err = storage.Remove(absFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		storage.RemoveAll(absTempPath)
+		return err
+	}
 
-		bucket.objects[key] = encodedValue
-		bucket.needsSave = true
+	err = storage.Rename(absTempPath, absFilePath)
+	if err != nil {
+		return err
 	}
 
-	os.Remove(absFilePath + ".swp")
 	b.needsSave = false
 	return nil
 }
 
-func (b *bucket) availablePath(rootPath string) (bucketPath, error) {
-	var filePath = rootPath
+func (b *bucket) availablePath(storage *bucketStorage) (bucketPath, error) {
+	var filePath = storage.rootPath
 	var path = bucketPath(b.id)
 	var step string
 
-	for step, path = path.Step(); step != ""; step, path = path.Step() {
+	for step, path = path.Step(storage.segmentLength); step != ""; step, path = path.Step(storage.segmentLength) {
 		filePath = filepath.Join(filePath, step)
 
-		fileInfo, err := os.Stat(filePath)
+		fileInfo, err := storage.Stat(filePath)
 		if os.IsNotExist(err) {
 			break
 		}
@@ -161,3 +246,61 @@ func (b *bucket) availablePath(rootPath string) (bucketPath, error) {
 
 	return bucketPath(b.id[0 : len(b.id)-len(path)]), nil
 }
+
+func loadObjects(storage *bucketStorage, absFilePath string) (map[string][]byte, error) {
+	objects, _, err := readObjects(storage, absFilePath)
+	return objects, err
+}
+
+func saveObjects(storage *bucketStorage, absFilePath string, objects map[string][]byte) error {
+	file, err := storage.CreateFile(absFilePath + ".swp")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	err = encoder.Encode(objects)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = storage.SyncFile(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return storage.Rename(absFilePath+".swp", absFilePath)
+}
+
+func readObjects(storage *bucketStorage, absFilePath string) (map[string][]byte, os.FileInfo, error) {
+	file, err := storage.Open(absFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string][]byte), nil, nil
+		}
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var objects map[string][]byte
+
+	decoder := json.NewDecoder(file)
+	err = decoder.Decode(&objects)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return objects, fileInfo, nil
+}
@@ -13,7 +13,7 @@ func TestBucket(t *testing.T) {
 		var b bucket
 		var dummy string
 
-		err := b.Get("not-a-valid-key", &dummy)
+		err := b.Get("not-a-valid-key", &dummy, JSONCodec)
 		if err == nil {
 			t.Fatalf("Expected ErrValueNotFound error but got nothing")
 		}
@@ -24,12 +24,12 @@ func TestBucket(t *testing.T) {
 
 	t.Run("Load() succeeds when file does not exist", func(t *testing.T) {
 		var b bucket
-		err := b.Load("non-existent-root-path", "bucket-id")
+		err := b.Load(newTestStorage("non-existent-root-path"), "bucket-id")
 		if err != nil {
 			t.Fatalf("Error while loading bucket: %v", err)
 		}
 
-		err = b.Put("some value", "abc123")
+		err = b.Put("some value", "abc123", JSONCodec)
 		if err != nil {
 			t.Fatalf("Error while adding value to bucket: %v", err)
 		}
@@ -42,13 +42,13 @@ func TestBucket(t *testing.T) {
 			t.Errorf("Expected %d objects but got %d", expected, count)
 		}
 
-		b.Put("a", 1)
+		b.Put("a", 1, JSONCodec)
 
 		if expected, count := 1, b.ObjectCount(); expected != count {
 			t.Errorf("Expected %d objects but got %d", expected, count)
 		}
 
-		b.Put("b", 2)
+		b.Put("b", 2, JSONCodec)
 
 		if expected, count := 2, b.ObjectCount(); expected != count {
 			t.Errorf("Expected %d objects but got %d", expected, count)
@@ -64,7 +64,7 @@ func TestBucket(t *testing.T) {
 
 		var b = newBucket("aabbc")
 
-		result, err := b.availablePath(rootPath)
+		result, err := b.availablePath(newTestStorage(rootPath))
 		if err != nil {
 			t.Fatalf("Error while generating bucket path: %v", err)
 		}
@@ -72,9 +72,9 @@ func TestBucket(t *testing.T) {
 			t.Errorf("Expected path '%s' but got '%s'", expected, result)
 		}
 
-		os.MkdirAll(filepath.Join(rootPath, result.PathString()), os.FileMode(0700))
+		os.MkdirAll(filepath.Join(rootPath, result.PathString(DefaultBucketPathSegmentLength)), os.FileMode(0700))
 
-		result, err = b.availablePath(rootPath)
+		result, err = b.availablePath(newTestStorage(rootPath))
 		if err != nil {
 			t.Fatalf("Error while generating bucket path: %v", err)
 		}
@@ -82,9 +82,9 @@ func TestBucket(t *testing.T) {
 			t.Errorf("Expected path '%s' but got '%s'", expected, result)
 		}
 
-		os.MkdirAll(filepath.Join(rootPath, result.PathString()), os.FileMode(0700))
+		os.MkdirAll(filepath.Join(rootPath, result.PathString(DefaultBucketPathSegmentLength)), os.FileMode(0700))
 
-		result, err = b.availablePath(rootPath)
+		result, err = b.availablePath(newTestStorage(rootPath))
 		if err != nil {
 			t.Fatalf("Error while generating bucket path: %v", err)
 		}
@@ -96,7 +96,7 @@ func TestBucket(t *testing.T) {
 	t.Run("Remove() makes existing object inaccessible", func(t *testing.T) {
 		var b = newBucket("aabb")
 
-		err := b.Put("some-key", "hello")
+		err := b.Put("some-key", "hello", JSONCodec)
 		if err != nil {
 			t.Fatalf("Error adding item to bucket: %v", err)
 		}
@@ -104,7 +104,7 @@ func TestBucket(t *testing.T) {
 		b.Remove("some-key")
 
 		var value string
-		err = b.Get("some-key", &value)
+		err = b.Get("some-key", &value, JSONCodec)
 		if err == nil {
 			t.Fatalf("Expected value to have been removed but got '%v'", value)
 		}
@@ -122,22 +122,22 @@ func TestBucket(t *testing.T) {
 		defer os.RemoveAll(rootPath)
 
 		var b1 = newBucket("aabb")
-		b1.path, _ = b1.availablePath(rootPath)
-		b1.Put("keyToTheApple", testValue{Name: "apple", Colour: "red"})
+		b1.path, _ = b1.availablePath(newTestStorage(rootPath))
+		b1.Put("keyToTheApple", testValue{Name: "apple", Colour: "red"}, JSONCodec)
 
-		err = b1.Save(rootPath)
+		err = b1.Save(newTestStorage(rootPath))
 		if err != nil {
 			t.Fatalf("Error saving bucket: %v", err)
 		}
 
 		var b2 bucket
-		err = b2.Load(rootPath, b1.id)
+		err = b2.Load(newTestStorage(rootPath), b1.id)
 		if err != nil {
 			t.Fatalf("Error loading bucket: %v", err)
 		}
 
 		var value testValue
-		err = b2.Get("keyToTheApple", &value)
+		err = b2.Get("keyToTheApple", &value, JSONCodec)
 		if err != nil {
 			t.Fatalf("Error fetching saved value: %v", err)
 		}
@@ -150,6 +150,42 @@ func TestBucket(t *testing.T) {
 		}
 	})
 
+	t.Run("Save() removes the file of an empty bucket", func(t *testing.T) {
+		var rootPath, err = ioutil.TempDir("", "keva-bucket-test")
+		if err != nil {
+			t.Fatalf("Error creating temporary location for bucket: %v", err)
+		}
+
+		defer os.RemoveAll(rootPath)
+
+		storage := newTestStorage(rootPath)
+
+		var b = newBucket("aabb")
+		b.path, _ = b.availablePath(storage)
+		b.Put("keyToTheApple", testValue{Name: "apple", Colour: "red"}, JSONCodec)
+
+		err = b.Save(storage)
+		if err != nil {
+			t.Fatalf("Error saving bucket: %v", err)
+		}
+
+		b.Remove("keyToTheApple")
+
+		err = b.Save(storage)
+		if err != nil {
+			t.Fatalf("Error saving bucket: %v", err)
+		}
+
+		if _, err := os.Stat(storage.AbsPath(b.path)); !os.IsNotExist(err) {
+			t.Errorf("Expected bucket file to be removed but got %v", err)
+		}
+
+		err = b.Save(storage)
+		if err != nil {
+			t.Errorf("Error saving bucket again: %v", err)
+		}
+	})
+
 	t.Run("Split() pushes objects to subdirectories", func(t *testing.T) {
 		var rootPath, err = ioutil.TempDir("", "keva-bucket-test")
 		if err != nil {
@@ -164,29 +200,25 @@ func TestBucket(t *testing.T) {
 		}
 
 		var b bucket
-		err = b.Load(rootPath, s.bucketIDForKey("aabb"))
+		err = b.Load(newTestStorage(rootPath), s.bucketIDForKey("aabb"))
 		if err != nil {
 			t.Fatalf("Error loading bucket: %v", err)
 		}
 
-		b.Put("aabb", "value1")
-		b.Put("aacc", "value2")
-		b.Save(rootPath)
+		// Both keys have IDs beginning with "48", so belong in the same bucket.
 
-		err = b.Split(rootPath, s.bucketForKey)
-		if err != nil {
-			t.Fatalf("Error splitting bucket: %v", err)
-		}
+		b.Put("aabb", "value1", JSONCodec)
+		b.Put("aacc225", "value2", JSONCodec)
+		b.Save(newTestStorage(rootPath))
 
-		s.readyToFlush = true
-		err = s.Flush()
+		err = b.Split(s.storage, s.bucketIDForKey)
 		if err != nil {
-			t.Fatalf("Error flushing store: %v", err)
+			t.Fatalf("Error splitting bucket: %v", err)
 		}
 
 		// Bucket with original ID should still contain first value
 
-		err = b.Load(rootPath, s.bucketIDForKey("aabb"))
+		err = b.Load(newTestStorage(rootPath), s.bucketIDForKey("aabb"))
 		if err != nil {
 			t.Fatalf("Error loading bucket: %v", err)
 		}
@@ -196,7 +228,7 @@ func TestBucket(t *testing.T) {
 
 		var value string
 
-		err = b.Get("aabb", &value)
+		err = b.Get("aabb", &value, JSONCodec)
 		if err != nil {
 			t.Errorf("Error retrieving value from bucket: %v", err)
 		}
@@ -206,14 +238,14 @@ func TestBucket(t *testing.T) {
 
 		// Second value should no longer be in this bucket
 
-		err = b.Get("aacc", &value)
+		err = b.Get("aacc225", &value, JSONCodec)
 		if err == nil {
 			t.Errorf("Expected error but got value '%v'", value)
 		}
 
 		// Second value should have been split into another bucket
 
-		err = b.Load(rootPath, s.bucketIDForKey("aacc"))
+		err = b.Load(newTestStorage(rootPath), s.bucketIDForKey("aacc225"))
 		if err != nil {
 			t.Fatalf("Error loading bucket: %v", err)
 		}
@@ -221,7 +253,7 @@ func TestBucket(t *testing.T) {
 			t.Errorf("Expected bucket to contain 1 object but got %d", count)
 		}
 
-		err = b.Get("aacc", &value)
+		err = b.Get("aacc225", &value, JSONCodec)
 		if err != nil {
 			t.Errorf("Error retrieving value from bucket: %v", err)
 		}
@@ -1,14 +1,26 @@
 package keva
 
+import (
+	"context"
+	"strings"
+)
+
+// bucketCache is an LRU cache of buckets which may belong to several stores.
+// Each store's buckets are indexed separately by its storage, and evicted
+// buckets are saved to the storage they came from.
 type bucketCache struct {
-	HitCount         uint64
-	MissCount        uint64
 	maxBucketsCached int
 	usedEntries      bucketCacheEntry
 	freeEntries      bucketCacheEntry
 	bucketsCached    int
 	buckets          []bucketCacheEntry
-	trieRoot         *bucketCacheTrie
+	owners           map[*bucketStorage]*bucketCacheOwner
+}
+
+type bucketCacheOwner struct {
+	HitCount  uint64
+	MissCount uint64
+	trieRoot  *bucketCacheTrie
 }
 
 func (c *bucketCache) Clear() {
@@ -23,23 +35,34 @@ func (c *bucketCache) Clear() {
 	}
 
 	c.bucketsCached = 0
-	c.trieRoot = newBucketCacheTrie()
+
+	for storage, owner := range c.owners {
+		owner.trieRoot = newBucketCacheTrie(storage.segmentLength)
+	}
 }
 
-func (c *bucketCache) Close(rootPath string) error {
-	err := c.Flush(rootPath)
+// Close flushes and discards the buckets belonging to storage.
+func (c *bucketCache) Close(storage *bucketStorage) error {
+	err := c.Flush(context.Background(), storage)
 	if err != nil {
 		return err
 	}
 
-	c.Clear()
+	c.Discard(storage)
 	return nil
 }
 
-func (c *bucketCache) Evict(bucketID string, rootPath string) error {
-	e := c.trieRoot.Remove(bucketPath(bucketID))
+// Discard removes the buckets belonging to storage without saving them, and
+// forgets its hit and miss counts.
+func (c *bucketCache) Discard(storage *bucketStorage) {
+	c.Invalidate(storage)
+	delete(c.owners, storage)
+}
+
+func (c *bucketCache) Evict(bucketID string, storage *bucketStorage) error {
+	e := c.owner(storage).trieRoot.Remove(bucketPath(bucketID))
 	if e != nil {
-		err := e.bucket.Save(rootPath)
+		err := e.bucket.Save(storage)
 		if err != nil {
 			return err
 		}
@@ -51,8 +74,33 @@ func (c *bucketCache) Evict(bucketID string, rootPath string) error {
 	return nil
 }
 
-func (c *bucketCache) Fetch(bucketID string, rootPath string, fetch func(string) (*bucket, error)) (*bucket, error) {
-	b := c.lookup(bucketID)
+// EvictUnder saves and removes the buckets at or beneath path belonging to
+// storage.
+func (c *bucketCache) EvictUnder(path bucketPath, storage *bucketStorage) error {
+	for e := c.usedEntries.next; e != &c.usedEntries; {
+		next := e.next
+
+		if e.storage == storage && strings.HasPrefix(string(e.bucket.path), string(path)) {
+			err := e.bucket.Save(storage)
+			if err != nil {
+				return err
+			}
+
+			c.owner(storage).trieRoot.Remove(e.bucket.path)
+			e.SpliceAfter(&c.freeEntries)
+			e.bucket = nil
+			e.storage = nil
+			c.bucketsCached--
+		}
+
+		e = next
+	}
+
+	return nil
+}
+
+func (c *bucketCache) Fetch(bucketID string, storage *bucketStorage, fetch func(string) (*bucket, error)) (*bucket, error) {
+	b := c.lookup(bucketID, storage)
 	if b != nil {
 		return b, nil
 	}
@@ -62,7 +110,7 @@ func (c *bucketCache) Fetch(bucketID string, rootPath string, fetch func(string)
 		return nil, err
 	}
 
-	err = c.encache(b, rootPath)
+	err = c.encache(b, storage)
 	if err != nil {
 		return nil, err
 	}
@@ -70,9 +118,18 @@ func (c *bucketCache) Fetch(bucketID string, rootPath string, fetch func(string)
 	return b, nil
 }
 
-func (c *bucketCache) Flush(rootPath string) error {
+// Flush saves the buckets belonging to storage, or every cached bucket if
+// storage is nil.
+func (c *bucketCache) Flush(ctx context.Context, storage *bucketStorage) error {
 	for e := c.usedEntries.next; e != &c.usedEntries; e = e.next {
-		err := e.bucket.Save(rootPath)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if storage != nil && e.storage != storage {
+			continue
+		}
+
+		err := e.bucket.Save(e.storage)
 		if err != nil {
 			return err
 		}
@@ -81,8 +138,50 @@ func (c *bucketCache) Flush(rootPath string) error {
 	return nil
 }
 
-func (c *bucketCache) SetMaxBucketsCached(n int, rootPath string) error {
-	err := c.Flush(rootPath)
+// Holds indicates whether b is cached for storage.
+func (c *bucketCache) Holds(b *bucket, storage *bucketStorage) bool {
+	e := c.owner(storage).trieRoot.Find(b.path)
+	return e != nil && e.bucket == b
+}
+
+// HoldsUnder indicates whether any buckets at or beneath path are cached for
+// storage.
+func (c *bucketCache) HoldsUnder(path bucketPath, storage *bucketStorage) bool {
+	return c.owner(storage).trieRoot.HasEntriesUnder(path)
+}
+
+func (c *bucketCache) Info(storage *bucketStorage) (hitCount, missCount uint64) {
+	owner, ok := c.owners[storage]
+	if !ok {
+		return 0, 0
+	}
+
+	return owner.HitCount, owner.MissCount
+}
+
+// Invalidate removes the buckets belonging to storage without saving them,
+// for when the layout of its buckets has changed beneath the cache.
+func (c *bucketCache) Invalidate(storage *bucketStorage) {
+	for e := c.usedEntries.next; e != &c.usedEntries; {
+		next := e.next
+
+		if e.storage == storage {
+			e.SpliceAfter(&c.freeEntries)
+			e.bucket = nil
+			e.storage = nil
+			c.bucketsCached--
+		}
+
+		e = next
+	}
+
+	if owner, ok := c.owners[storage]; ok {
+		owner.trieRoot = newBucketCacheTrie(storage.segmentLength)
+	}
+}
+
+func (c *bucketCache) SetMaxBucketsCached(n int) error {
+	err := c.Flush(context.Background(), nil)
 	if err != nil {
 		return err
 	}
@@ -92,13 +191,13 @@ func (c *bucketCache) SetMaxBucketsCached(n int, rootPath string) error {
 	return nil
 }
 
-func (c *bucketCache) encache(b *bucket, rootPath string) error {
+func (c *bucketCache) encache(b *bucket, storage *bucketStorage) error {
 	var e *bucketCacheEntry
 
 	if c.bucketsCached >= c.maxBucketsCached {
 		e = c.usedEntries.prev
-		c.trieRoot.Remove(e.bucket.path)
-		err := e.bucket.Save(rootPath)
+		c.owner(e.storage).trieRoot.Remove(e.bucket.path)
+		err := e.bucket.Save(e.storage)
 		if err != nil {
 			return err
 		}
@@ -110,26 +209,40 @@ func (c *bucketCache) encache(b *bucket, rootPath string) error {
 
 	e.SpliceAfter(&c.usedEntries)
 	e.bucket = b
+	e.storage = storage
 
-	c.trieRoot.Insert(e)
+	c.owner(storage).trieRoot.Insert(e)
 	return nil
 }
 
-func (c *bucketCache) lookup(id string) *bucket {
-	e := c.trieRoot.Find(bucketPath(id))
+func (c *bucketCache) lookup(id string, storage *bucketStorage) *bucket {
+	owner := c.owner(storage)
+
+	e := owner.trieRoot.Find(bucketPath(id))
 	if e != nil {
-		c.HitCount++
+		owner.HitCount++
 		e.SpliceAfter(&c.usedEntries)
 		return e.bucket
 	}
 
-	c.MissCount++
+	owner.MissCount++
 	return nil
 }
 
+func (c *bucketCache) owner(storage *bucketStorage) *bucketCacheOwner {
+	owner, ok := c.owners[storage]
+	if !ok {
+		owner = &bucketCacheOwner{trieRoot: newBucketCacheTrie(storage.segmentLength)}
+		c.owners[storage] = owner
+	}
+
+	return owner
+}
+
 func newBucketCache(maxBucketsCached int) *bucketCache {
 	c := &bucketCache{
 		maxBucketsCached: maxBucketsCached,
+		owners:           make(map[*bucketStorage]*bucketCacheOwner),
 	}
 	c.Clear()
 
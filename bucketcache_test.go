@@ -17,15 +17,16 @@ func TestBucketCache(t *testing.T) {
 		b2 := newBucket("bucket2")
 		b2.path = "ab"
 
+		storage := newTestStorage("")
 		c := newBucketCache(DefaultMaxBucketsCached)
 
 		b := b1
-		c.Fetch("ab", "", func(string) (*bucket, error) { return b, nil })
+		c.Fetch("ab", storage, func(string) (*bucket, error) { return b, nil })
 
 		c.Clear()
 
 		b = b2
-		result, err := c.Fetch("ab", "", func(string) (*bucket, error) { return b, nil })
+		result, err := c.Fetch("ab", storage, func(string) (*bucket, error) { return b, nil })
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -41,15 +42,16 @@ func TestBucketCache(t *testing.T) {
 		b2 := newBucket("bucket2")
 		b2.path = "ab"
 
+		storage := newTestStorage("")
 		c := newBucketCache(DefaultMaxBucketsCached)
 
 		b := b1
-		c.Fetch("ab", "", func(string) (*bucket, error) { return b, nil })
+		c.Fetch("ab", storage, func(string) (*bucket, error) { return b, nil })
 
-		c.Evict("ab", "")
+		c.Evict("ab", storage)
 
 		b = b2
-		result, err := c.Fetch("ab", "", func(string) (*bucket, error) { return b, nil })
+		result, err := c.Fetch("ab", storage, func(string) (*bucket, error) { return b, nil })
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -60,9 +62,10 @@ func TestBucketCache(t *testing.T) {
 
 	t.Run("Fetch() delegates to fetcher function", func(t *testing.T) {
 		b := newBucket("bucket")
+		storage := newTestStorage("")
 		c := newBucketCache(DefaultMaxBucketsCached)
 
-		result, err := c.Fetch("ab", "", func(string) (*bucket, error) { return b, nil })
+		result, err := c.Fetch("ab", storage, func(string) (*bucket, error) { return b, nil })
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -74,6 +77,7 @@ func TestBucketCache(t *testing.T) {
 	t.Run("Fetch() only caches requested number of values", func(t *testing.T) {
 		count := 0
 
+		storage := newTestStorage("")
 		c := newBucketCache(2)
 
 		fetch := func(id string) (*bucket, error) {
@@ -88,7 +92,7 @@ func TestBucketCache(t *testing.T) {
 
 		// First fetch should get a new bucket 01-1
 
-		result, err := c.Fetch("01", "", fetch)
+		result, err := c.Fetch("01", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -98,7 +102,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Second fetch should get a new bucket 02-2
 
-		result, err = c.Fetch("02", "", fetch)
+		result, err = c.Fetch("02", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -108,7 +112,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Fetching the first ID again should return cached 01-1
 
-		result, err = c.Fetch("01", "", fetch)
+		result, err = c.Fetch("01", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -118,7 +122,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Fetching a new ID should get a new bucket 03-3 (and evict 02-2)
 
-		result, err = c.Fetch("03", "", fetch)
+		result, err = c.Fetch("03", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -128,7 +132,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Fetching the first ID again should still return cached 01-1
 
-		result, err = c.Fetch("01", "", fetch)
+		result, err = c.Fetch("01", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -139,7 +143,7 @@ func TestBucketCache(t *testing.T) {
 		// Second ID should have been evicted, so fetching it again should get a
 		// new bucket 02-4.
 
-		result, err = c.Fetch("02", "", fetch)
+		result, err = c.Fetch("02", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -154,6 +158,7 @@ func TestBucketCache(t *testing.T) {
 			t.Fatalf("Could not create temporary location: %v", err)
 		}
 
+		storage := newTestStorage(rootPath)
 		c := newBucketCache(2)
 
 		fetch := func(id string) (*bucket, error) {
@@ -164,7 +169,7 @@ func TestBucketCache(t *testing.T) {
 
 		// First fetch should get a new bucket 01
 
-		result, err := c.Fetch("01", rootPath, fetch)
+		result, err := c.Fetch("01", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -174,7 +179,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Second fetch should get a new bucket 02
 
-		bucketToEvict, err := c.Fetch("02", rootPath, fetch)
+		bucketToEvict, err := c.Fetch("02", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -183,14 +188,14 @@ func TestBucketCache(t *testing.T) {
 		}
 
 		// Add something to 02 to make it dirty
-		err = bucketToEvict.Put("someKey", "someValue")
+		err = bucketToEvict.Put("someKey", "someValue", JSONCodec)
 		if err != nil {
 			t.Fatalf("Error adding object to bucket: %v", err)
 		}
 
 		// Fetching the first ID again should return cached 01
 
-		result, err = c.Fetch("01", rootPath, fetch)
+		result, err = c.Fetch("01", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -200,7 +205,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Bucket 02 should not have been flushed to disk yet
 
-		evictedBucketPath := filepath.Join(rootPath, bucketToEvict.path.PathString())
+		evictedBucketPath := filepath.Join(rootPath, bucketToEvict.path.PathString(DefaultBucketPathSegmentLength))
 		_, err = os.Stat(evictedBucketPath)
 		if err != nil {
 			if !os.IsNotExist(err) {
@@ -210,7 +215,7 @@ func TestBucketCache(t *testing.T) {
 
 		// Fetching a new ID should get a new bucket 03 (and evict 02)
 
-		result, err = c.Fetch("03", rootPath, fetch)
+		result, err = c.Fetch("03", storage, fetch)
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
@@ -236,13 +241,14 @@ func TestBucketCache(t *testing.T) {
 		b2 := newBucket("bucket2")
 		b2.path = bucketPath("bucket")
 
+		storage := newTestStorage("")
 		c := newBucketCache(DefaultMaxBucketsCached)
 
 		b := b1
-		c.Fetch("bucket1", "", func(string) (*bucket, error) { return b, nil })
+		c.Fetch("bucket1", storage, func(string) (*bucket, error) { return b, nil })
 
 		b = b2
-		result, err := c.Fetch("bucket1", "", func(string) (*bucket, error) { return b, nil })
+		result, err := c.Fetch("bucket1", storage, func(string) (*bucket, error) { return b, nil })
 		if err != nil {
 			t.Errorf("Expected success but got error: %v", err)
 		}
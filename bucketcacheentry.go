@@ -1,9 +1,10 @@
 package keva
 
 type bucketCacheEntry struct {
-	bucket *bucket
-	prev   *bucketCacheEntry
-	next   *bucketCacheEntry
+	bucket  *bucket
+	storage *bucketStorage
+	prev    *bucketCacheEntry
+	next    *bucketCacheEntry
 }
 
 func (e *bucketCacheEntry) Init() *bucketCacheEntry {
@@ -1,15 +1,16 @@
 package keva
 
 type bucketCacheTrie struct {
-	entry    *bucketCacheEntry
-	parent   *bucketCacheTrie
-	children map[string]*bucketCacheTrie
+	entry         *bucketCacheEntry
+	parent        *bucketCacheTrie
+	children      map[string]*bucketCacheTrie
+	segmentLength int
 }
 
 func (t *bucketCacheTrie) Find(path bucketPath) *bucketCacheEntry {
 	node := t
 
-	for step, next := path.Step(); step != ""; step, next = next.Step() {
+	for step, next := path.Step(t.segmentLength); step != ""; step, next = next.Step(t.segmentLength) {
 		child, ok := node.children[step]
 		if !ok {
 			break
@@ -21,13 +22,31 @@ func (t *bucketCacheTrie) Find(path bucketPath) *bucketCacheEntry {
 	return node.entry
 }
 
+// HasEntriesUnder indicates whether any entries are held at or beneath path.
+// Nodes are removed along with their last entry, so this is the case whenever
+// the node for path exists.
+func (t *bucketCacheTrie) HasEntriesUnder(path bucketPath) bool {
+	node := t
+
+	for step, next := path.Step(t.segmentLength); step != ""; step, next = next.Step(t.segmentLength) {
+		child, ok := node.children[step]
+		if !ok {
+			return false
+		}
+
+		node = child
+	}
+
+	return node.entry != nil || len(node.children) > 0
+}
+
 func (t *bucketCacheTrie) Insert(e *bucketCacheEntry) {
 	node := t
 
-	for step, path := e.bucket.path.Step(); step != ""; step, path = path.Step() {
+	for step, path := e.bucket.path.Step(t.segmentLength); step != ""; step, path = path.Step(t.segmentLength) {
 		child, ok := node.children[step]
 		if !ok {
-			child = newBucketCacheTrie()
+			child = newBucketCacheTrie(t.segmentLength)
 			child.parent = node
 			node.children[step] = child
 		}
@@ -42,7 +61,7 @@ func (t *bucketCacheTrie) Remove(path bucketPath) *bucketCacheEntry {
 	segments := []string{}
 	node := t
 
-	for step, next := path.Step(); step != ""; step, next = next.Step() {
+	for step, next := path.Step(t.segmentLength); step != ""; step, next = next.Step(t.segmentLength) {
 		child, ok := node.children[step]
 		if !ok {
 			break
@@ -64,8 +83,9 @@ func (t *bucketCacheTrie) Remove(path bucketPath) *bucketCacheEntry {
 	return entry
 }
 
-func newBucketCacheTrie() *bucketCacheTrie {
+func newBucketCacheTrie(segmentLength int) *bucketCacheTrie {
 	return &bucketCacheTrie{
-		children: make(map[string]*bucketCacheTrie),
+		children:      make(map[string]*bucketCacheTrie),
+		segmentLength: segmentLength,
 	}
 }
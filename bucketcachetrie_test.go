@@ -17,7 +17,7 @@ func TestBucketCacheTrie(t *testing.T) {
 		var e2 = &bucketCacheEntry{bucket: b2}
 		e2.Init()
 
-		trie := newBucketCacheTrie()
+		trie := newBucketCacheTrie(DefaultBucketPathSegmentLength)
 		trie.Insert(e1)
 		trie.Insert(e2)
 
@@ -36,7 +36,7 @@ func TestBucketCacheTrie(t *testing.T) {
 		var b = newBucket("aabbc")
 		b.path = bucketPath("aabbc")
 
-		trie := newBucketCacheTrie()
+		trie := newBucketCacheTrie(DefaultBucketPathSegmentLength)
 		result := trie.Find(b.path)
 
 		if result != nil {
@@ -44,6 +44,35 @@ func TestBucketCacheTrie(t *testing.T) {
 		}
 	})
 
+	t.Run("HasEntriesUnder() indicates whether entries are held beneath a path", func(t *testing.T) {
+		var b = newBucket("aabbcc")
+		b.path = bucketPath("aabbcc")
+
+		var e = &bucketCacheEntry{bucket: b}
+		e.Init()
+
+		trie := newBucketCacheTrie(DefaultBucketPathSegmentLength)
+		trie.Insert(e)
+
+		for _, path := range []bucketPath{"aa", "aabb", "aabbcc"} {
+			if !trie.HasEntriesUnder(path) {
+				t.Errorf("Expected entries under '%s'", path)
+			}
+		}
+
+		for _, path := range []bucketPath{"ab", "aabc", "aabbccdd"} {
+			if trie.HasEntriesUnder(path) {
+				t.Errorf("Expected no entries under '%s'", path)
+			}
+		}
+
+		trie.Remove(b.path)
+
+		if trie.HasEntriesUnder("aa") {
+			t.Errorf("Expected no entries after removal")
+		}
+	})
+
 	t.Run("Insert() should add entry at end of recursive path", func(t *testing.T) {
 		var b = newBucket("aabbc")
 		b.path = bucketPath("aabbc")
@@ -51,7 +80,7 @@ func TestBucketCacheTrie(t *testing.T) {
 		var e = &bucketCacheEntry{bucket: b}
 		e.Init()
 
-		trie := newBucketCacheTrie()
+		trie := newBucketCacheTrie(DefaultBucketPathSegmentLength)
 		trie.Insert(e)
 
 		if result, expected := len(trie.children), 1; result != expected {
@@ -100,7 +129,7 @@ func TestBucketCacheTrie(t *testing.T) {
 		var e2 = &bucketCacheEntry{bucket: b2}
 		e2.Init()
 
-		trie := newBucketCacheTrie()
+		trie := newBucketCacheTrie(DefaultBucketPathSegmentLength)
 		trie.Insert(e1)
 		trie.Insert(e2)
 
@@ -118,7 +147,7 @@ func TestBucketCacheTrie(t *testing.T) {
 		var e = &bucketCacheEntry{bucket: b}
 		e.Init()
 
-		trie := newBucketCacheTrie()
+		trie := newBucketCacheTrie(DefaultBucketPathSegmentLength)
 		trie.Insert(e)
 
 		result := trie.Remove(b.path)
@@ -5,15 +5,23 @@ import (
 	"os"
 )
 
-const bucketPathSegmentLength = 2
-
+// bucketPath is the path of a bucket, formed from a prefix of the bucket IDs
+// it holds. Each segment of segmentLength characters names a directory level.
 type bucketPath string
 
-func (p bucketPath) PathString() string {
+func (p bucketPath) Parent(segmentLength int) bucketPath {
+	if p == "" {
+		return ""
+	}
+
+	return p[:(len(p)-1)/segmentLength*segmentLength]
+}
+
+func (p bucketPath) PathString(segmentLength int) string {
 	var result bytes.Buffer
 
-	for i, end := 0, len(p); i < end; i += bucketPathSegmentLength {
-		j := i + bucketPathSegmentLength
+	for i, end := 0, len(p); i < end; i += segmentLength {
+		j := i + segmentLength
 		if j >= end {
 			result.WriteString(string(p[i:end]))
 			break
@@ -26,10 +34,10 @@ func (p bucketPath) PathString() string {
 	return result.String()
 }
 
-func (p bucketPath) Step() (step string, remainder bucketPath) {
-	if len(p) < bucketPathSegmentLength {
+func (p bucketPath) Step(segmentLength int) (step string, remainder bucketPath) {
+	if len(p) < segmentLength {
 		return string(p), ""
 	}
 
-	return string(p[:2]), p[2:]
+	return string(p[:segmentLength]), p[segmentLength:]
 }
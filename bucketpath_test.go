@@ -10,13 +10,13 @@ func TestBucketPath(t *testing.T) {
 	t.Run("PathString() returns a filesystem path", func(t *testing.T) {
 		var p = bucketPath("aabbc")
 
-		if result, expected := p.PathString(), filepath.Join("aa", "bb", "c"); result != expected {
+		if result, expected := p.PathString(2), filepath.Join("aa", "bb", "c"); result != expected {
 			t.Errorf("Expected '%s' but got '%s'", expected, result)
 		}
 
 		p = bucketPath("aabb")
 
-		if result, expected := p.PathString(), filepath.Join("aa", "bb"); result != expected {
+		if result, expected := p.PathString(2), filepath.Join("aa", "bb"); result != expected {
 			t.Errorf("Expected '%s' but got '%s'", expected, result)
 		}
 	})
@@ -24,7 +24,7 @@ func TestBucketPath(t *testing.T) {
 	t.Run("Step() returns the next step and the remainder", func(t *testing.T) {
 		var p = bucketPath("aabbc")
 
-		step, p := p.Step()
+		step, p := p.Step(2)
 
 		if result, expected := step, "aa"; result != expected {
 			t.Errorf("Expected step '%s' but got '%s'", expected, result)
@@ -33,7 +33,7 @@ func TestBucketPath(t *testing.T) {
 			t.Errorf("Expected remainder '%s' but got '%s'", expected, result)
 		}
 
-		step, p = p.Step()
+		step, p = p.Step(2)
 
 		if result, expected := step, "bb"; result != expected {
 			t.Errorf("Expected step '%s' but got '%s'", expected, result)
@@ -42,7 +42,7 @@ func TestBucketPath(t *testing.T) {
 			t.Errorf("Expected remainder '%s' but got '%s'", expected, result)
 		}
 
-		step, p = p.Step()
+		step, p = p.Step(2)
 
 		if result, expected := step, "c"; result != expected {
 			t.Errorf("Expected step '%s' but got '%s'", expected, result)
@@ -51,7 +51,7 @@ func TestBucketPath(t *testing.T) {
 			t.Errorf("Expected empty remainder but got '%s'", result)
 		}
 
-		step, p = p.Step()
+		step, p = p.Step(2)
 
 		if result, expected := step, ""; result != expected {
 			t.Errorf("Expected empty step but got '%s'", result)
@@ -60,4 +60,25 @@ func TestBucketPath(t *testing.T) {
 			t.Errorf("Expected empty remainder but got '%s'", result)
 		}
 	})
+
+	t.Run("Parent() and Step() use the given segment length", func(t *testing.T) {
+		var p = bucketPath("aaabbbc")
+
+		if result, expected := p.Parent(3), bucketPath("aaabbb"); result != expected {
+			t.Errorf("Expected parent '%s' but got '%s'", expected, result)
+		}
+		if result, expected := bucketPath("aaabbb").Parent(3), bucketPath("aaa"); result != expected {
+			t.Errorf("Expected parent '%s' but got '%s'", expected, result)
+		}
+
+		step, remainder := p.Step(3)
+
+		if step != "aaa" || remainder != "bbbc" {
+			t.Errorf("Expected step 'aaa' and remainder 'bbbc' but got '%s' and '%s'", step, remainder)
+		}
+
+		if result, expected := p.PathString(3), filepath.Join("aaa", "bbb", "c"); result != expected {
+			t.Errorf("Expected '%s' but got '%s'", expected, result)
+		}
+	})
 }
@@ -0,0 +1,115 @@
+package keva
+
+import (
+	"context"
+	"sync"
+)
+
+// Cache is a write-back cache of buckets which can be shared by several stores
+// by opening them WithCache, so that a single limit and eviction policy
+// governs all of their buckets. A bucket evicted to make room for another
+// store's bucket is saved to the store it belongs to.
+//
+// Stores opened without WithCache each get a cache of their own.
+type Cache struct {
+	lock    sync.Mutex
+	buckets *bucketCache
+}
+
+// SetMaxBuckets flushes every store using the cache, and changes the number
+// of buckets the cache holds. An error wrapping ErrInvalidOption is returned
+// if n is not positive.
+func (c *Cache) SetMaxBuckets(n int) error {
+	err := validateMaxBucketsCached(n)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.SetMaxBucketsCached(n)
+}
+
+func (c *Cache) close(storage *bucketStorage) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.Close(storage)
+}
+
+func (c *Cache) discard(storage *bucketStorage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.buckets.Discard(storage)
+}
+
+func (c *Cache) evict(bucketID string, storage *bucketStorage) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.Evict(bucketID, storage)
+}
+
+func (c *Cache) evictUnder(path bucketPath, storage *bucketStorage) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.EvictUnder(path, storage)
+}
+
+func (c *Cache) fetch(bucketID string, storage *bucketStorage, fetch func(string) (*bucket, error)) (*bucket, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.Fetch(bucketID, storage, fetch)
+}
+
+func (c *Cache) flush(ctx context.Context, storage *bucketStorage) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.Flush(ctx, storage)
+}
+
+func (c *Cache) holds(b *bucket, storage *bucketStorage) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.Holds(b, storage)
+}
+
+func (c *Cache) holdsUnder(path bucketPath, storage *bucketStorage) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.HoldsUnder(path, storage)
+}
+
+func (c *Cache) info(storage *bucketStorage) (hitCount, missCount uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.buckets.Info(storage)
+}
+
+func (c *Cache) invalidate(storage *bucketStorage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.buckets.Invalidate(storage)
+}
+
+// NewCache returns a cache which holds up to maxBuckets buckets. An error
+// wrapping ErrInvalidOption is returned if maxBuckets is not positive.
+func NewCache(maxBuckets int) (*Cache, error) {
+	err := validateMaxBucketsCached(maxBuckets)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		buckets: newBucketCache(maxBuckets),
+	}, nil
+}
@@ -0,0 +1,135 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+
+	newCache := func(maxBuckets int, t *testing.T) *Cache {
+		c, err := NewCache(maxBuckets)
+		if err != nil {
+			t.Fatalf("Could not create cache: %v", err)
+		}
+
+		return c
+	}
+
+	t.Run("Stores sharing a cache keep their own values", func(t *testing.T) {
+		c := newCache(2, t)
+
+		s1 := newTempStore(t, WithCache(c), WithMaxObjectsPerBucket(4))
+		defer s1.Destroy()
+		s2 := newTempStore(t, WithCache(c), WithMaxObjectsPerBucket(4))
+		defer s2.Destroy()
+
+		for i := 0; i < 50; i++ {
+			err := s1.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("one%d", i))
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+			err = s2.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("two%d", i))
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		for i := 0; i < 50; i++ {
+			var result string
+
+			err := s1.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value: %v", err)
+			}
+			if expected := fmt.Sprintf("one%d", i); result != expected {
+				t.Errorf("Expected '%s' but got '%s'", expected, result)
+			}
+
+			err = s2.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value: %v", err)
+			}
+			if expected := fmt.Sprintf("two%d", i); result != expected {
+				t.Errorf("Expected '%s' but got '%s'", expected, result)
+			}
+		}
+	})
+
+	t.Run("Buckets evicted by another store are saved to their own store", func(t *testing.T) {
+		c := newCache(1, t)
+
+		s1 := newTempStore(t, WithCache(c), WithMaxObjectsPerBucket(4))
+		defer s1.Destroy()
+		s2 := newTempStore(t, WithCache(c), WithMaxObjectsPerBucket(4))
+		defer s2.Destroy()
+
+		s1.Put("abc123", "apple")
+		s2.Put("abc123", "banana")
+
+		var result string
+
+		err := s1.Get("abc123", &result)
+		if err != nil {
+			t.Fatalf("Error when retrieving value: %v", err)
+		}
+		if result != "apple" {
+			t.Errorf("Expected 'apple' but got '%s'", result)
+		}
+
+		reopened, err := OpenReadOnly(s2.rootPath, WithLiveUpdates())
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+		defer reopened.Close()
+
+		err = reopened.Get("abc123", &result)
+		if err != nil {
+			t.Fatalf("Expected evicted bucket to have been saved but got %v", err)
+		}
+		if result != "banana" {
+			t.Errorf("Expected 'banana' but got '%s'", result)
+		}
+	})
+
+	t.Run("Closing a store leaves other stores' buckets cached", func(t *testing.T) {
+		c := newCache(DefaultMaxBucketsCached, t)
+
+		s1 := newTempStore(t, WithCache(c), WithMaxObjectsPerBucket(4))
+		defer os.RemoveAll(s1.rootPath)
+		s2 := newTempStore(t, WithCache(c), WithMaxObjectsPerBucket(4))
+		defer s2.Destroy()
+
+		s1.Put("abc123", "apple")
+		s2.Put("abc123", "banana")
+
+		err := s1.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		var result string
+
+		s2.Get("abc123", &result)
+
+		if info := s2.Info(); info.CacheHitCount != 1 || info.CacheMissCount != 1 {
+			t.Errorf("Expected 1 hit and 1 miss but got %+v", info)
+		}
+	})
+
+	t.Run("NewCache() and SetMaxBuckets() reject non-positive sizes", func(t *testing.T) {
+		_, err := NewCache(0)
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("Expected ErrInvalidOption but got %v", err)
+		}
+
+		c := newCache(1, t)
+
+		err = c.SetMaxBuckets(-1)
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("Expected ErrInvalidOption but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package keva
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrUnsupportedCodec indicates that an operation cannot be performed with
+// the store's configured codec.
+var ErrUnsupportedCodec = errors.New("operation not supported by codec")
+
+// Codec encodes and decodes the values held in a store. The codec's name is
+// recorded in the store's manifest, and a store can only be reopened with a
+// codec of the same name.
+type Codec interface {
+	Name() string
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(encodedValue []byte, dest interface{}) error
+}
+
+// StrictCodec is implemented by codecs which can decode values strictly,
+// rejecting encoded values which don't correspond exactly to the type of the
+// destination. TypedStore uses strict decoding where it is available.
+type StrictCodec interface {
+	Codec
+	UnmarshalStrict(encodedValue []byte, dest interface{}) error
+}
+
+// JSONCodec encodes values as JSON. It is the default codec, and implements
+// StrictCodec by rejecting objects with fields the destination doesn't have.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(encodedValue []byte, dest interface{}) error {
+	return json.Unmarshal(encodedValue, dest)
+}
+
+func (jsonCodec) UnmarshalStrict(encodedValue []byte, dest interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(encodedValue))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(dest)
+}
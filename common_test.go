@@ -1,5 +1,10 @@
 package keva
 
+import (
+	"io/ioutil"
+	"testing"
+)
+
 type testValue struct {
 	Name   string `json:"name"`
 	Colour string `json:"colour"`
@@ -8,3 +13,23 @@ type testValue struct {
 func newBucket(id string) *bucket {
 	return &bucket{id: id, objects: make(map[string][]byte)}
 }
+
+func newTempDir(t *testing.T) string {
+	rootPath, err := ioutil.TempDir("", "keva-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary location: %v", err)
+	}
+	return rootPath
+}
+
+func newTempStore(t *testing.T, opts ...Option) *Store {
+	store, err := NewStore(newTempDir(t), opts...)
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	return store
+}
+
+func newTestStorage(rootPath string) *bucketStorage {
+	return newBucketStorage(rootPath, newOptions(nil))
+}
@@ -0,0 +1,145 @@
+package keva
+
+import "path/filepath"
+
+// Compact merges directories of buckets back into single buckets wherever
+// their objects together would fill no more than half a bucket under the
+// store's split policy, reversing splits left unnecessary by removals.
+// Pending changes are flushed first, and the store is unavailable until
+// compaction finishes.
+//
+// Each merge writes the merged bucket before swapping it in for the
+// directory, and merges interrupted by a crash are completed or discarded
+// when the store is next opened.
+func (s *Store) Compact() error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mutationLock.Lock()
+	defer s.mutationLock.Unlock()
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	err = s.flushLocked()
+	if err != nil {
+		return err
+	}
+
+	// Merging moves buckets, so none can remain cached at their old paths.
+
+	s.cache.invalidate(s.storage)
+	s.digests = make(map[bucketPath]Digest)
+
+	_, _, err = s.compactDir(s.rootPath)
+	return err
+}
+
+// compactDir merges the directories beneath absDirPath whose buckets together
+// are small enough to merge. If the same is true of absDirPath itself, its
+// objects are returned for merging by the caller.
+func (s *Store) compactDir(absDirPath string) (objects map[string][]byte, mergeable bool, err error) {
+	entries, err := s.storage.ReadDir(absDirPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	objects = make(map[string][]byte)
+	mergeable = true
+
+	for _, entry := range entries {
+		if !isBucketName(entry.Name()) {
+			continue
+		}
+
+		absPath := filepath.Join(absDirPath, entry.Name())
+
+		var childObjects map[string][]byte
+
+		if entry.IsDir() {
+			var childMergeable bool
+
+			childObjects, childMergeable, err = s.compactDir(absPath)
+			if err != nil {
+				return nil, false, err
+			}
+			if !childMergeable {
+				mergeable = false
+				continue
+			}
+
+			err = mergeBucketDir(s.storage, absPath, childObjects)
+			if err != nil {
+				return nil, false, err
+			}
+
+		} else if mergeable {
+			childObjects, err = loadObjects(s.storage, absPath)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		if mergeable {
+			for key, encodedValue := range childObjects {
+				objects[key] = encodedValue
+			}
+
+			mergeable = s.splitPolicy.allowsMerge(len(objects), objectsSize(objects))
+		}
+	}
+
+	if !mergeable {
+		objects = nil
+	}
+
+	return objects, mergeable, nil
+}
+
+// mergeBucketDir replaces the directory of buckets at absDirPath with a single
+// bucket holding the given objects. Directories holding no objects are simply
+// removed, as an empty bucket has no file.
+func mergeBucketDir(storage *bucketStorage, absDirPath string, objects map[string][]byte) error {
+	if len(objects) == 0 {
+		return storage.RemoveAll(absDirPath)
+	}
+
+	return replaceBucketTree(storage, absDirPath, func(absNewPath string) error {
+		return saveObjects(storage, absNewPath, objects)
+	})
+}
+
+// replaceBucketTree replaces the bucket or directory of buckets at absPath
+// with the one written by write. The replacement is written alongside the
+// original and swapped in once complete, so that recoverLayout can complete
+// or discard the replacement if a crash interrupts it.
+func replaceBucketTree(storage *bucketStorage, absPath string, write func(absNewPath string) error) error {
+	absNewPath := absPath + replacementSuffix
+	absOldPath := absPath + replacedSuffix
+
+	err := write(absNewPath)
+	if err != nil {
+		storage.RemoveAll(absNewPath)
+		return err
+	}
+
+	err = storage.Rename(absPath, absOldPath)
+	if err != nil {
+		storage.RemoveAll(absNewPath)
+		return err
+	}
+
+	err = storage.Rename(absNewPath, absPath)
+	if err != nil {
+		return err
+	}
+
+	return storage.RemoveAll(absOldPath)
+}
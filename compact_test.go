@@ -0,0 +1,202 @@
+package keva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+
+	countDirs := func(rootPath string, t *testing.T) int {
+		count := 0
+
+		err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() && path != rootPath {
+				count++
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		return count
+	}
+
+	newStoreWithRemovals := func(t *testing.T) *Store {
+		rootPath, err := ioutil.TempDir("", "keva-compact-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(4))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		for i := 0; i < 500; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		for i := 0; i < 500; i++ {
+			if i%5 == 0 {
+				continue
+			}
+
+			err = s.Remove(fmt.Sprintf("key%d", i))
+			if err != nil {
+				t.Fatalf("Error when removing value: %v", err)
+			}
+		}
+
+		return s
+	}
+
+	expectRemainingValues := func(s *Store, t *testing.T) {
+		for i := 0; i < 500; i++ {
+			var result int
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+
+			if i%5 != 0 {
+				if err != ErrValueNotFound {
+					t.Errorf("Expected removed key %d to be missing but got %v", i, err)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	}
+
+	t.Run("Compact() merges directories whose buckets hold few objects", func(t *testing.T) {
+		s := newStoreWithRemovals(t)
+		defer s.Destroy()
+
+		err := s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		dirsBefore := countDirs(s.rootPath, t)
+
+		err = s.Compact()
+		if err != nil {
+			t.Fatalf("Error when compacting store: %v", err)
+		}
+
+		if dirsAfter := countDirs(s.rootPath, t); dirsAfter >= dirsBefore {
+			t.Errorf("Expected fewer than %d directories after compaction but found %d", dirsBefore, dirsAfter)
+		}
+
+		expectRemainingValues(s, t)
+	})
+
+	t.Run("Compact() leaves a store which can be written and reopened", func(t *testing.T) {
+		s := newStoreWithRemovals(t)
+
+		err := s.Compact()
+		if err != nil {
+			t.Fatalf("Error when compacting store: %v", err)
+		}
+
+		for i := 500; i < 600; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		err = s.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		s, err = NewStore(s.rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Destroy()
+
+		expectRemainingValues(s, t)
+
+		for i := 500; i < 600; i++ {
+			var result int
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	})
+
+	t.Run("Compact() leaves directories whose buckets are too full to merge", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-compact-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(4))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Destroy()
+
+		for i := 0; i < 100; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		err = s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		dirsBefore := countDirs(rootPath, t)
+
+		err = s.Compact()
+		if err != nil {
+			t.Fatalf("Error when compacting store: %v", err)
+		}
+
+		if dirsAfter := countDirs(rootPath, t); dirsAfter != dirsBefore {
+			t.Errorf("Expected %d directories after compaction but found %d", dirsBefore, dirsAfter)
+		}
+	})
+
+	t.Run("Compact() returns ErrReadOnly for read-only stores", func(t *testing.T) {
+		s := newStoreWithRemovals(t)
+		defer os.RemoveAll(s.rootPath)
+
+		err := s.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		r, err := OpenReadOnly(s.rootPath)
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+		defer r.Close()
+
+		if err := r.Compact(); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package keva
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+
+	t.Run("PutContext() and GetContext() can be roundtripped", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		ctx := context.Background()
+
+		err := s.PutContext(ctx, "abc123", "hello")
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+
+		var result string
+
+		err = s.GetContext(ctx, "abc123", &result)
+		if err != nil {
+			t.Fatalf("Error when retrieving value: %v", err)
+		}
+		if result != "hello" {
+			t.Errorf("Expected 'hello' but got '%s'", result)
+		}
+
+		err = s.RemoveContext(ctx, "abc123")
+		if err != nil {
+			t.Fatalf("Error when removing value: %v", err)
+		}
+
+		err = s.FlushContext(ctx)
+		if err != nil {
+			t.Fatalf("Error when flushing: %v", err)
+		}
+	})
+
+	t.Run("Operations give up when the store is busy past the deadline", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		s.storeLock.Lock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		var value string
+
+		if err := s.GetContext(ctx, "a", &value); err != context.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded from GetContext() but got %v", err)
+		}
+		if err := s.PutContext(ctx, "a", "b"); err != context.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded from PutContext() but got %v", err)
+		}
+		if err := s.RemoveContext(ctx, "a"); err != context.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded from RemoveContext() but got %v", err)
+		}
+		if err := s.FlushContext(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded from FlushContext() but got %v", err)
+		}
+
+		s.storeLock.Unlock()
+	})
+
+	t.Run("Operations give up while waiting for a bucket lock partition", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		id := s.bucketIDForKey("a")
+		held := make(chan struct{})
+		release := make(chan struct{})
+
+		go s.bucketLock.WithMutex(id[0:DefaultBucketPathSegmentLength], func() {
+			close(held)
+			<-release
+		})
+		<-held
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := s.PutContext(ctx, "a", "b"); err != context.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded from PutContext() but got %v", err)
+		}
+
+		close(release)
+
+		if err := s.Put("a", "b"); err != nil {
+			t.Errorf("Expected lock to be usable again but got %v", err)
+		}
+	})
+}
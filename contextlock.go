@@ -0,0 +1,74 @@
+package keva
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mandykoh/symlock"
+)
+
+// contextMutex is a mutex which can be waited on with a context, so that a
+// caller can give up waiting when its context is done. The zero value is an
+// unlocked mutex.
+type contextMutex struct {
+	init sync.Once
+	held chan struct{}
+}
+
+func (m *contextMutex) Lock() {
+	m.init.Do(m.initialise)
+	m.held <- struct{}{}
+}
+
+func (m *contextMutex) LockContext(ctx context.Context) error {
+	m.init.Do(m.initialise)
+
+	select {
+	case m.held <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *contextMutex) Unlock() {
+	<-m.held
+}
+
+func (m *contextMutex) initialise() {
+	m.held = make(chan struct{}, 1)
+}
+
+// withSymbolLock runs action while holding the lock for symbol. If ctx is done
+// before the lock is acquired, action is not run and the context's error is
+// returned.
+func withSymbolLock(ctx context.Context, lock *symlock.SymLock, symbol string, action func()) error {
+	if ctx.Done() == nil {
+		lock.WithMutex(symbol, action)
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	acquired := make(chan struct{})
+	release := make(chan struct{})
+
+	go lock.WithMutex(symbol, func() {
+		close(acquired)
+		<-release
+	})
+
+	select {
+	case <-acquired:
+		defer close(release)
+		action()
+		return nil
+
+	case <-ctx.Done():
+		// The lock will be released as soon as it is eventually acquired.
+		close(release)
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,172 @@
+package keva
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Diff compares the contents of two stores and returns the keys whose values
+// differ between them, including keys present in only one of the stores.
+// Keys belonging to namespaces are not included.
+//
+// Only subtrees whose digests differ are descended into, so stores which are
+// mostly identical can be compared without reading every bucket. Stores with
+// different bucket path segment lengths or hash functions are compared in
+// full, with every object of both stores loaded into memory at once. Both
+// stores are flushed as they are compared.
+//
+// Values are compared as they are stored, so an error wrapping
+// ErrIncompatibleStore is returned if the stores use different codecs.
+func Diff(a, b *Store) ([]string, error) {
+	err := checkSameCodec(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+
+	err = diff(a, b, "", func(key string, aValue, bValue []byte) error {
+		if !isReservedKey(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Sync repairs dest so that its contents match those of src, transferring
+// only the objects in buckets whose digests differ. Objects present in dest
+// but not in src are removed. Namespaces are synchronised along with the
+// store's other keys, and src's namespaces are registered in dest.
+//
+// If the stores have different bucket path segment lengths or hash
+// functions, their buckets can't be compared, so every object of both stores
+// is loaded into memory at once and compared in full.
+//
+// Values are copied as they are stored, so an error wrapping
+// ErrIncompatibleStore is returned if the stores use different codecs.
+func Sync(dest, src *Store) error {
+	err := checkSameCodec(dest, src)
+	if err != nil {
+		return err
+	}
+
+	err = copyNamespaces(dest, src)
+	if err != nil {
+		return err
+	}
+
+	return diff(src, dest, "", func(key string, srcValue, destValue []byte) error {
+		if srcValue == nil {
+			return dest.removeKey(context.Background(), key)
+		}
+
+		return dest.putEncoded(context.Background(), key, srcValue)
+	})
+}
+
+func checkSameCodec(a, b *Store) error {
+	if a.codec.Name() != b.codec.Name() {
+		return fmt.Errorf("%w: stores use codecs '%s' and '%s'", ErrIncompatibleStore, a.codec.Name(), b.codec.Name())
+	}
+
+	return nil
+}
+
+func diff(a, b *Store, path bucketPath, action func(key string, aValue, bValue []byte) error) error {
+	// Stores which place keys differently can't be compared bucket by
+	// bucket, so are compared in full.
+
+	if sameLayout(a, b) {
+		aNode, err := a.digestNode(path)
+		if err != nil {
+			return err
+		}
+
+		bNode, err := b.digestNode(path)
+		if err != nil {
+			return err
+		}
+
+		if aNode.kind == bNode.kind && aNode.digest == bNode.digest {
+			return nil
+		}
+
+		if aNode.kind == digestNodeDir && bNode.kind == digestNodeDir {
+			for _, name := range mergeNames(aNode.children, bNode.children) {
+				err = diff(a, b, path+bucketPath(name), action)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+	}
+
+	aObjects, err := a.objectsUnder(path)
+	if err != nil {
+		return err
+	}
+
+	bObjects, err := b.objectsUnder(path)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+
+	for key, aValue := range aObjects {
+		if bValue, ok := bObjects[key]; !ok || !bytes.Equal(aValue, bValue) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range bObjects {
+		if _, ok := aObjects[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err = action(key, aObjects[key], bObjects[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mergeNames(a, b []string) []string {
+	var result []string
+
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0] < b[0]:
+			result = append(result, a[0])
+			a = a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			result = append(result, b[0])
+			b = b[1:]
+		default:
+			result = append(result, a[0])
+			a = a[1:]
+			b = b[1:]
+		}
+	}
+
+	return result
+}
+
+func sameLayout(a, b *Store) bool {
+	return a.storage.segmentLength == b.storage.segmentLength && a.hashFunction == b.hashFunction
+}
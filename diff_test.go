@@ -0,0 +1,226 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+
+	putAll := func(s *Store, count int, t *testing.T) {
+		for i := 0; i < count; i++ {
+			err := s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+	}
+
+	t.Run("Digest() is the same for stores with the same contents", func(t *testing.T) {
+		a := newTempStore(t)
+		defer a.Destroy()
+		b := newTempStore(t)
+		defer b.Destroy()
+
+		putAll(a, 100, t)
+		putAll(b, 100, t)
+
+		aDigest, err := a.Digest()
+		if err != nil {
+			t.Fatalf("Error computing digest: %v", err)
+		}
+		bDigest, err := b.Digest()
+		if err != nil {
+			t.Fatalf("Error computing digest: %v", err)
+		}
+
+		if aDigest != bDigest {
+			t.Errorf("Expected digests to match but got %x and %x", aDigest, bDigest)
+		}
+
+		b.Put("key0", "changed")
+
+		bDigest, err = b.Digest()
+		if err != nil {
+			t.Fatalf("Error computing digest: %v", err)
+		}
+
+		if aDigest == bDigest {
+			t.Errorf("Expected digests to differ after change")
+		}
+	})
+
+	t.Run("Diff() returns keys which differ", func(t *testing.T) {
+		a := newTempStore(t)
+		defer a.Destroy()
+		b := newTempStore(t)
+		defer b.Destroy()
+
+		b.SetMaxObjectsPerBucket(1)
+
+		putAll(a, 300, t)
+		putAll(b, 300, t)
+
+		a.Put("key7", "changed")
+		a.Put("onlyInA", 1)
+		b.Remove("key42")
+
+		keys, err := Diff(a, b)
+		if err != nil {
+			t.Fatalf("Error comparing stores: %v", err)
+		}
+
+		expected := []string{"key42", "key7", "onlyInA"}
+
+		if len(keys) != len(expected) {
+			t.Fatalf("Expected keys %v but got %v", expected, keys)
+		}
+		for i := range expected {
+			if keys[i] != expected[i] {
+				t.Errorf("Expected keys %v but got %v", expected, keys)
+			}
+		}
+	})
+
+	t.Run("Sync() makes destination match source", func(t *testing.T) {
+		src := newTempStore(t)
+		defer src.Destroy()
+		dest := newTempStore(t)
+		defer dest.Destroy()
+
+		putAll(src, 300, t)
+		putAll(dest, 300, t)
+
+		src.Put("key7", "changed")
+		src.Remove("key8")
+		dest.Put("onlyInDest", 1)
+
+		err := Sync(dest, src)
+		if err != nil {
+			t.Fatalf("Error synchronising stores: %v", err)
+		}
+
+		keys, err := Diff(src, dest)
+		if err != nil {
+			t.Fatalf("Error comparing stores: %v", err)
+		}
+		if len(keys) != 0 {
+			t.Errorf("Expected no differences but got %v", keys)
+		}
+
+		var value string
+		err = dest.Get("key7", &value)
+		if err != nil {
+			t.Fatalf("Error retrieving value: %v", err)
+		}
+		if value != "changed" {
+			t.Errorf("Expected 'changed' but got '%s'", value)
+		}
+	})
+
+	t.Run("Diff() compares stores with different layouts", func(t *testing.T) {
+		a := newTempStore(t, WithMaxObjectsPerBucket(1))
+		defer a.Destroy()
+		b := newTempStore(t, WithMaxObjectsPerBucket(1), WithBucketPathSegmentLength(1), WithHashFunction(FNV1a128))
+		defer b.Destroy()
+
+		putAll(a, 100, t)
+		putAll(b, 100, t)
+
+		err := b.Put("key7", "changed")
+		if err == nil {
+			err = b.Remove("key8")
+		}
+		if err == nil {
+			err = b.Put("extra", 1)
+		}
+		if err != nil {
+			t.Fatalf("Error when modifying store: %v", err)
+		}
+
+		keys, err := Diff(a, b)
+		if err != nil {
+			t.Fatalf("Error comparing stores: %v", err)
+		}
+
+		if result, expected := fmt.Sprint(keys), "[extra key7 key8]"; result != expected {
+			t.Errorf("Expected differences %s but got %s", expected, result)
+		}
+	})
+
+	t.Run("Diff() and Sync() reject stores with different codecs", func(t *testing.T) {
+		a := newTempStore(t)
+		defer a.Destroy()
+		b := newTempStore(t, WithCodec(gobCodec{}))
+		defer b.Destroy()
+
+		putAll(a, 10, t)
+
+		_, err := Diff(a, b)
+		if !errors.Is(err, ErrIncompatibleStore) {
+			t.Errorf("Expected ErrIncompatibleStore from Diff() but got %v", err)
+		}
+
+		err = Sync(b, a)
+		if !errors.Is(err, ErrIncompatibleStore) {
+			t.Errorf("Expected ErrIncompatibleStore from Sync() but got %v", err)
+		}
+
+		var value int
+
+		err = b.Get("key1", &value)
+		if err != ErrValueNotFound {
+			t.Errorf("Expected nothing to be synchronised but got %v", err)
+		}
+	})
+
+	t.Run("Sync() copies namespaces, which Diff() leaves out", func(t *testing.T) {
+		src := newTempStore(t)
+		defer src.Destroy()
+		dest := newTempStore(t)
+		defer dest.Destroy()
+
+		ns, err := src.Namespace("fruit")
+		if err != nil {
+			t.Fatalf("Error when obtaining namespace: %v", err)
+		}
+
+		err = ns.Put("x", "apple")
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+
+		keys, err := Diff(src, dest)
+		if err != nil {
+			t.Fatalf("Error comparing stores: %v", err)
+		}
+		if len(keys) != 0 {
+			t.Errorf("Expected no differences but got %q", keys)
+		}
+
+		err = Sync(dest, src)
+		if err != nil {
+			t.Fatalf("Error synchronising stores: %v", err)
+		}
+
+		if result, expected := fmt.Sprint(dest.Namespaces()), "[fruit]"; result != expected {
+			t.Errorf("Expected namespaces %s but got %s", expected, result)
+		}
+
+		ns, err = dest.Namespace("fruit")
+		if err != nil {
+			t.Fatalf("Error when obtaining namespace: %v", err)
+		}
+
+		var value string
+
+		err = ns.Get("x", &value)
+		if err != nil {
+			t.Fatalf("Error when retrieving value: %v", err)
+		}
+		if value != "apple" {
+			t.Errorf("Expected 'apple' but got '%s'", value)
+		}
+	})
+}
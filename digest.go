@@ -0,0 +1,227 @@
+package keva
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+)
+
+// Digest is a hash summarising the contents of a bucket or of a directory of
+// buckets. Two subtrees with the same layout and the same contents have the
+// same digest.
+type Digest [sha256.Size]byte
+
+type digestNodeKind int
+
+const (
+	digestNodeMissing digestNodeKind = iota
+	digestNodeFile
+	digestNodeDir
+)
+
+type digestNode struct {
+	kind     digestNodeKind
+	digest   Digest
+	children []string
+}
+
+// Digest returns the digest of the whole store, flushing any pending changes
+// first. Stores with identical contents and layouts have identical digests.
+func (s *Store) Digest() (Digest, error) {
+	node, err := s.digestNode("")
+	if err != nil {
+		return Digest{}, err
+	}
+
+	return node.digest, nil
+}
+
+func (s *Store) digestNode(path bucketPath) (node digestNode, err error) {
+	err = s.beginOperation()
+	if err != nil {
+		return
+	}
+	defer s.endOperation()
+
+	s.mutationLock.Lock()
+	defer s.mutationLock.Unlock()
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	err = s.flushLocked()
+	if err != nil {
+		return
+	}
+
+	absPath := s.storage.AbsPath(path)
+
+	fileInfo, err := s.storage.Stat(absPath)
+	if os.IsNotExist(err) {
+		return digestNode{kind: digestNodeMissing}, nil
+	}
+	if err != nil {
+		return
+	}
+
+	if fileInfo.IsDir() {
+		node.kind = digestNodeDir
+		node.children, err = bucketNames(s.storage, absPath)
+		if err != nil {
+			return
+		}
+	} else {
+		node.kind = digestNodeFile
+	}
+
+	node.digest, err = s.digestLocked(path, absPath, node.kind == digestNodeDir)
+	return
+}
+
+func (s *Store) digestLocked(path bucketPath, absPath string, isDir bool) (Digest, error) {
+	if digest, ok := s.digests[path]; ok {
+		return digest, nil
+	}
+
+	var digest Digest
+
+	if isDir {
+		children, err := s.storage.ReadDir(absPath)
+		if err != nil {
+			return digest, err
+		}
+
+		hash := sha256.New()
+
+		for _, child := range children {
+			if !isBucketName(child.Name()) {
+				continue
+			}
+
+			childDigest, err := s.digestLocked(path+bucketPath(child.Name()), filepath.Join(absPath, child.Name()), child.IsDir())
+			if err != nil {
+				return digest, err
+			}
+
+			hash.Write([]byte(child.Name()))
+			hash.Write([]byte{0})
+			hash.Write(childDigest[:])
+		}
+
+		copy(digest[:], hash.Sum(nil))
+
+	} else {
+		content, err := s.storage.ReadFile(absPath)
+		if err != nil {
+			return digest, err
+		}
+
+		digest = sha256.Sum256(content)
+	}
+
+	// Another process may change the files of a store with live updates, so
+	// digests can't be remembered.
+
+	if !s.liveUpdates {
+		s.digests[path] = digest
+	}
+
+	return digest, nil
+}
+
+// objectsUnder returns all the encoded objects stored in the subtree at the
+// given path, flushing any pending changes first.
+func (s *Store) objectsUnder(path bucketPath) (map[string][]byte, error) {
+	err := s.beginOperation()
+	if err != nil {
+		return nil, err
+	}
+	defer s.endOperation()
+
+	s.mutationLock.Lock()
+	defer s.mutationLock.Unlock()
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	err = s.flushLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(map[string][]byte)
+
+	err = walkBucketFiles(s.storage, s.storage.AbsPath(path), func(absFilePath string) error {
+		bucketObjects, err := loadObjects(s.storage, absFilePath)
+		if err != nil {
+			return err
+		}
+
+		for key, encodedValue := range bucketObjects {
+			objects[key] = encodedValue
+		}
+
+		return nil
+	})
+
+	return objects, err
+}
+
+func bucketNames(storage *bucketStorage, absDirPath string) ([]string, error) {
+	entries, err := storage.ReadDir(absDirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		if isBucketName(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func isBucketName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func walkBucketFiles(storage *bucketStorage, absPath string, action func(absFilePath string) error) error {
+	fileInfo, err := storage.Stat(absPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !fileInfo.IsDir() {
+		return action(absPath)
+	}
+
+	names, err := bucketNames(storage, absPath)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		err = walkBucketFiles(storage, filepath.Join(absPath, name), action)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
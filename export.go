@@ -0,0 +1,189 @@
+package keva
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrKeyExists indicates that an imported key was already present in the
+// store when ImportFailOnConflict was specified.
+var ErrKeyExists = errors.New("key already exists")
+
+// ImportConflictPolicy determines what Import does with a key which already
+// exists in the store.
+type ImportConflictPolicy int
+
+const (
+	// ImportOverwrite replaces existing values with imported ones.
+	ImportOverwrite ImportConflictPolicy = iota
+
+	// ImportSkipExisting keeps existing values and ignores imported ones.
+	ImportSkipExisting
+
+	// ImportFailOnConflict stops the import with ErrKeyExists.
+	ImportFailOnConflict
+)
+
+// ImportOptions controls the behaviour of Import.
+type ImportOptions struct {
+	OnConflict ImportConflictPolicy
+}
+
+type exportRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Export writes every object in the store to w in JSON Lines format, as one
+// {"key":...,"value":...} object per line. Pending changes are flushed first,
+// and writes to the store are held off until the export completes.
+//
+// Values are written as they are stored, so ErrUnsupportedCodec is returned
+// unless the store uses JSONCodec. The same applies to Import.
+func (s *Store) Export(w io.Writer) error {
+	if s.codec.Name() != JSONCodec.Name() {
+		return ErrUnsupportedCodec
+	}
+
+	encoder := json.NewEncoder(w)
+
+	return s.forEachObject(func(key string, encodedValue []byte) error {
+		return encoder.Encode(exportRecord{Key: key, Value: encodedValue})
+	})
+}
+
+// Import bulk loads objects from r in the JSON Lines format written by
+// Export. Buckets are only split once all the objects have been loaded,
+// rather than repeatedly as they fill up.
+//
+// If ImportFailOnConflict is specified and a key already exists, the import
+// stops with an error wrapping ErrKeyExists; objects imported before the
+// conflicting key remain in the store.
+func (s *Store) Import(r io.Reader, opts ImportOptions) (err error) {
+	if s.codec.Name() != JSONCodec.Name() {
+		return ErrUnsupportedCodec
+	}
+
+	err = s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mutationLock.RLock()
+	defer s.mutationLock.RUnlock()
+
+	oversizedBuckets := make(map[string]bool)
+
+	// Buckets filled by the import are split even if it fails part way, so
+	// that none are left oversized.
+
+	defer func() {
+		for id := range oversizedBuckets {
+			splitErr := s.withBucketForID(context.Background(), id, func(bucket *bucket) error {
+				defer s.invalidateDigests(bucket.path)
+				return s.splitIfNeeded(id, bucket)
+			})
+			if err == nil {
+				err = splitErr
+			}
+		}
+	}()
+
+	decoder := json.NewDecoder(r)
+
+	for {
+		var record exportRecord
+
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var encodedValue bytes.Buffer
+
+		err = json.Compact(&encodedValue, record.Value)
+		if err != nil {
+			return err
+		}
+
+		id := s.bucketIDForKey(record.Key)
+
+		err = s.withBucketForID(context.Background(), id, func(bucket *bucket) error {
+			if _, exists := bucket.objects[record.Key]; exists {
+				switch opts.OnConflict {
+				case ImportSkipExisting:
+					return nil
+				case ImportFailOnConflict:
+					return fmt.Errorf("%w: '%s'", ErrKeyExists, record.Key)
+				}
+			}
+
+			s.changeKey(bucket, record.Key, true, func() {
+				bucket.PutEncoded(record.Key, encodedValue.Bytes())
+			})
+
+			s.markChanged(bucket.path)
+
+			if s.needsSplit(bucket) {
+				oversizedBuckets[id] = true
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachObject calls action with every object in the store. Pending changes
+// are flushed first and writes are held off until iteration completes, so
+// action must not modify the store.
+func (s *Store) forEachObject(action func(key string, encodedValue []byte) error) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	s.mutationLock.Lock()
+	defer s.mutationLock.Unlock()
+
+	s.storeLock.Lock()
+	err = s.flushLocked()
+	s.storeLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return walkBucketFiles(s.storage, s.rootPath, func(absFilePath string) error {
+		objects, err := loadObjects(s.storage, absFilePath)
+		if err != nil {
+			return err
+		}
+
+		for key, encodedValue := range objects {
+			err = action(key, encodedValue)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,139 @@
+package keva
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+
+	t.Run("Export() and Import() can be roundtripped between layouts", func(t *testing.T) {
+		src := newTempStore(t)
+		defer src.Destroy()
+
+		for i := 0; i < 1000; i++ {
+			src.Put(fmt.Sprintf("key%d", i), testValue{Name: fmt.Sprintf("name%d", i), Colour: "red"})
+		}
+
+		var exported bytes.Buffer
+
+		err := src.Export(&exported)
+		if err != nil {
+			t.Fatalf("Error exporting store: %v", err)
+		}
+
+		if lines := strings.Count(exported.String(), "\n"); lines != 1000 {
+			t.Errorf("Expected 1000 lines but got %d", lines)
+		}
+
+		dest := newTempStore(t)
+		defer dest.Destroy()
+
+		dest.SetMaxObjectsPerBucket(2)
+
+		err = dest.Import(&exported, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Error importing store: %v", err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key%d", i)
+
+			var value testValue
+			err = dest.Get(key, &value)
+			if err != nil {
+				t.Fatalf("Error retrieving value: %v", err)
+			}
+			if expected := fmt.Sprintf("name%d", i); value.Name != expected {
+				t.Errorf("Expected '%s' but got '%s'", expected, value.Name)
+			}
+
+			b, err := dest.bucketForKey(key)
+			if err != nil {
+				t.Fatalf("Error retrieving bucket: %v", err)
+			}
+			if count := b.ObjectCount(); count > 2 {
+				t.Errorf("Bucket %s had %d objects when maximum was 2", b.path, count)
+			}
+		}
+	})
+
+	t.Run("Import() applies conflict policy to existing keys", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		input := "{\"key\":\"a\",\"value\":\"new\"}\n{\"key\":\"b\",\"value\":\"new\"}\n"
+
+		expectValue := func(key, expected string, t *testing.T) {
+			var value string
+			err := s.Get(key, &value)
+			if err != nil {
+				t.Fatalf("Error retrieving value: %v", err)
+			}
+			if value != expected {
+				t.Errorf("Expected '%s' for key '%s' but got '%s'", expected, key, value)
+			}
+		}
+
+		s.Put("a", "old")
+
+		err := s.Import(strings.NewReader(input), ImportOptions{OnConflict: ImportSkipExisting})
+		if err != nil {
+			t.Fatalf("Error importing: %v", err)
+		}
+		expectValue("a", "old", t)
+		expectValue("b", "new", t)
+
+		s.Put("b", "old")
+
+		err = s.Import(strings.NewReader(input), ImportOptions{OnConflict: ImportFailOnConflict})
+		if !errors.Is(err, ErrKeyExists) {
+			t.Errorf("Expected ErrKeyExists but got %v", err)
+		}
+
+		err = s.Import(strings.NewReader(input), ImportOptions{OnConflict: ImportOverwrite})
+		if err != nil {
+			t.Fatalf("Error importing: %v", err)
+		}
+		expectValue("a", "new", t)
+		expectValue("b", "new", t)
+	})
+
+	t.Run("Import() splits buckets filled before a failure", func(t *testing.T) {
+		s := newTempStore(t, WithMaxObjectsPerBucket(4), WithBucketPathSegmentLength(1))
+		defer s.Destroy()
+
+		var input strings.Builder
+
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(&input, "{\"key\":\"key%d\",\"value\":%d}\n", i, i)
+		}
+		input.WriteString("not json\n")
+
+		err := s.Import(strings.NewReader(input.String()), ImportOptions{})
+		if err == nil {
+			t.Fatalf("Expected an error but got nothing")
+		}
+
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("key%d", i)
+
+			err = s.withBucketForID(context.Background(), s.bucketIDForKey(key), func(bucket *bucket) error {
+				if _, ok := bucket.objects[key]; !ok {
+					t.Errorf("Expected '%s' to have been imported", key)
+				}
+				if len(bucket.objects) > 4 {
+					t.Errorf("Expected at most 4 objects per bucket but got %d", len(bucket.objects))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Error when retrieving bucket: %v", err)
+			}
+		}
+	})
+}
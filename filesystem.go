@@ -0,0 +1,75 @@
+package keva
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// FileSystem is the interface through which a store accesses its files. Names
+// are paths in the form used by the os package, beginning with the store's
+// root path. Errors for missing files should satisfy os.IsNotExist.
+//
+// Stores use OSFileSystem unless WithFileSystem is specified. Stores on other
+// filesystems are not locked against being opened by other processes, and
+// snapshots copy bucket files rather than hard linking them.
+type FileSystem interface {
+
+	// Create creates or truncates the named file, opening it for writing.
+	Create(name string, perm os.FileMode) (File, error)
+
+	Mkdir(name string, perm os.FileMode) error
+
+	// Open opens the named file or directory for reading. Directories are
+	// only opened so that they can be synced.
+	Open(name string) (File, error)
+
+	// ReadDir returns the entries of the named directory, sorted by name.
+	ReadDir(name string) ([]os.FileInfo, error)
+
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+
+	Rename(oldName, newName string) error
+	Stat(name string) (os.FileInfo, error)
+}
+
+// File is a file opened from a FileSystem.
+type File interface {
+	io.ReadWriteCloser
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// OSFileSystem is the FileSystem provided by the operating system.
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Create(name string, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (osFileSystem) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (osFileSystem) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
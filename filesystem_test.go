@@ -0,0 +1,122 @@
+package keva
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type failingFileSystem struct {
+	FileSystem
+	lock          sync.Mutex
+	calls         map[string]int
+	opened        map[string]int
+	failRenamesTo string
+}
+
+func (fs *failingFileSystem) Create(name string, perm os.FileMode) (File, error) {
+	fs.record("Create")
+	return fs.FileSystem.Create(name, perm)
+}
+
+func (fs *failingFileSystem) Open(name string) (File, error) {
+	fs.record("Open")
+
+	fs.lock.Lock()
+	fs.opened[name]++
+	fs.lock.Unlock()
+
+	return fs.FileSystem.Open(name)
+}
+
+func (fs *failingFileSystem) Rename(oldName, newName string) error {
+	fs.record("Rename")
+
+	if fs.failRenamesTo != "" && strings.HasPrefix(newName, fs.failRenamesTo) {
+		return errors.New("injected rename failure")
+	}
+
+	return fs.FileSystem.Rename(oldName, newName)
+}
+
+func (fs *failingFileSystem) record(op string) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.calls[op]++
+}
+
+func TestFileSystem(t *testing.T) {
+
+	t.Run("Store accesses files through the given filesystem", func(t *testing.T) {
+		fs := &failingFileSystem{FileSystem: OSFileSystem, calls: make(map[string]int), opened: make(map[string]int)}
+
+		s := newTempStore(t, WithFileSystem(fs))
+		defer s.Destroy()
+
+		s.Put("abc123", "apple")
+
+		err := s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		for _, op := range []string{"Create", "Open", "Rename"} {
+			if fs.calls[op] == 0 {
+				t.Errorf("Expected %s() to have been called on the filesystem", op)
+			}
+		}
+	})
+
+	t.Run("Flush() returns filesystem errors", func(t *testing.T) {
+		fs := &failingFileSystem{FileSystem: OSFileSystem, calls: make(map[string]int), opened: make(map[string]int)}
+
+		s := newTempStore(t, WithFileSystem(fs))
+		defer s.Destroy()
+
+		fs.failRenamesTo = s.rootPath
+
+		s.Put("abc123", "apple")
+
+		err := s.Flush()
+		if err == nil {
+			t.Fatalf("Expected flush to fail")
+		}
+
+		fs.failRenamesTo = ""
+
+		err = s.Flush()
+		if err != nil {
+			t.Fatalf("Expected flush to succeed once the filesystem recovered but got %v", err)
+		}
+
+		var result string
+
+		err = s.Get("abc123", &result)
+		if err != nil || result != "apple" {
+			t.Errorf("Expected 'apple' but got '%s' (%v)", result, err)
+		}
+	})
+
+	t.Run("SyncDirectories syncs directories after renames", func(t *testing.T) {
+		fs := &failingFileSystem{FileSystem: OSFileSystem, calls: make(map[string]int), opened: make(map[string]int)}
+
+		s := newTempStore(t, WithFileSystem(fs), WithSyncMode(SyncDirectories))
+		defer s.Destroy()
+
+		opened := fs.opened[s.rootPath]
+
+		s.Put("abc123", "apple")
+
+		err := s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		if fs.opened[s.rootPath] <= opened {
+			t.Errorf("Expected store directory to be opened for syncing")
+		}
+	})
+}
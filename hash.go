@@ -0,0 +1,45 @@
+package keva
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+)
+
+// HashFunction determines how keys are placed in buckets. Each key's bucket
+// ID is the hex encoded hash of the key, and is split into segments to form
+// the path of the bucket holding it. The hash function is recorded in the
+// store's manifest when the store is created and cannot be changed afterwards
+// except by Reshard.
+type HashFunction string
+
+const (
+	// SHA256 places keys using SHA-256. It is the default, and spreads keys
+	// evenly among buckets whatever their distribution.
+	SHA256 HashFunction = "sha256"
+
+	// FNV1a128 places keys using the 128-bit FNV-1a hash, which is much
+	// cheaper to compute than SHA-256 but is not cryptographic, so keys
+	// chosen adversarially may be concentrated in a few buckets.
+	FNV1a128 HashFunction = "fnv1a128"
+)
+
+// bucketID returns the bucket ID of key.
+func (h HashFunction) bucketID(key string) string {
+	switch h {
+	case FNV1a128:
+		hash := fnv.New128a()
+		hash.Write([]byte(key))
+		return hex.EncodeToString(hash.Sum(nil))
+
+	default:
+		hash := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(hash[:])
+	}
+}
+
+// isSupported indicates whether h names a hash function supported by this
+// package.
+func (h HashFunction) isSupported() bool {
+	return h == SHA256 || h == FNV1a128
+}
@@ -0,0 +1,303 @@
+package kevatest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mandykoh/keva"
+)
+
+// Factory creates a new, empty KeyValue for each test run by RunConformance.
+// It also returns a function which closes the KeyValue and reopens it with
+// the same contents. That function may be nil for implementations which
+// don't persist values, in which case persistence is not tested.
+//
+// Factories should register any cleanup they need with t.Cleanup.
+type Factory func(t *testing.T) (kv keva.KeyValue, reopen func() (keva.KeyValue, error))
+
+type conformanceValue struct {
+	Name  string
+	Count int
+}
+
+// RunConformance runs a suite of tests against the KeyValue implementation
+// created by factory, checking that it behaves like a keva Store. It covers
+// missing keys, overwrites, removal, growth across the counts at which a
+// store's buckets split, persistence across reopening, and concurrent access,
+// which is best run with the race detector enabled.
+//
+// Growth is tested up to somewhat beyond keva.DefaultMaxObjectsPerBucket
+// objects, so stores configured with a smaller maximum are split repeatedly.
+func RunConformance(t *testing.T, factory Factory) {
+
+	expectValue := func(kv keva.KeyValue, key string, expected conformanceValue, t *testing.T) {
+		t.Helper()
+
+		var result conformanceValue
+
+		err := kv.Get(key, &result)
+		if err != nil {
+			t.Fatalf("Error when retrieving value for '%s': %v", key, err)
+		}
+		if result != expected {
+			t.Fatalf("Expected %+v for '%s' but got %+v", expected, key, result)
+		}
+	}
+
+	expectNotFound := func(kv keva.KeyValue, key string, t *testing.T) {
+		t.Helper()
+
+		var result conformanceValue
+
+		err := kv.Get(key, &result)
+		if err != keva.ErrValueNotFound {
+			t.Fatalf("Expected ErrValueNotFound for '%s' but got %v", key, err)
+		}
+	}
+
+	put := func(kv keva.KeyValue, key string, value conformanceValue, t *testing.T) {
+		t.Helper()
+
+		err := kv.Put(key, value)
+		if err != nil {
+			t.Fatalf("Error when storing value for '%s': %v", key, err)
+		}
+	}
+
+	keyFor := func(i int) string {
+		return fmt.Sprintf("conformance-key-%d", i)
+	}
+
+	valueFor := func(i int) conformanceValue {
+		return conformanceValue{Name: fmt.Sprintf("value %d", i), Count: i}
+	}
+
+	t.Run("Get() returns ErrValueNotFound for missing keys", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		expectNotFound(kv, "missing", t)
+	})
+
+	t.Run("Put() and Get() can be roundtripped", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		put(kv, "apple", conformanceValue{Name: "apple", Count: 3}, t)
+		expectValue(kv, "apple", conformanceValue{Name: "apple", Count: 3}, t)
+	})
+
+	t.Run("Put() overwrites existing values", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		put(kv, "apple", conformanceValue{Name: "apple", Count: 3}, t)
+		put(kv, "apple", conformanceValue{Name: "apple", Count: 4}, t)
+		expectValue(kv, "apple", conformanceValue{Name: "apple", Count: 4}, t)
+	})
+
+	t.Run("Remove() removes values", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		put(kv, "apple", conformanceValue{Name: "apple"}, t)
+		put(kv, "banana", conformanceValue{Name: "banana"}, t)
+
+		err := kv.Remove("apple")
+		if err != nil {
+			t.Fatalf("Error when removing value: %v", err)
+		}
+
+		expectNotFound(kv, "apple", t)
+		expectValue(kv, "banana", conformanceValue{Name: "banana"}, t)
+	})
+
+	t.Run("Remove() succeeds for missing keys", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		err := kv.Remove("missing")
+		if err != nil {
+			t.Fatalf("Error when removing missing value: %v", err)
+		}
+	})
+
+	t.Run("Put() keeps every value as keys are added", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		// Check everything just before, at and after each power of two, where
+		// buckets configured with power of two limits split.
+
+		nextCheck := 1
+
+		for i := 0; i <= 2*keva.DefaultMaxObjectsPerBucket+1; i++ {
+			put(kv, keyFor(i), valueFor(i), t)
+			expectValue(kv, keyFor(i), valueFor(i), t)
+
+			if count := i + 1; count >= nextCheck-1 && count <= nextCheck+1 {
+				for j := 0; j <= i; j++ {
+					expectValue(kv, keyFor(j), valueFor(j), t)
+				}
+				expectNotFound(kv, keyFor(i+1), t)
+
+				if count == nextCheck+1 {
+					nextCheck *= 2
+				}
+			}
+		}
+	})
+
+	t.Run("Remove() keeps other values as keys are removed", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		const count = 300
+
+		for i := 0; i < count; i++ {
+			put(kv, keyFor(i), valueFor(i), t)
+		}
+
+		for i := 0; i < count; i += 2 {
+			err := kv.Remove(keyFor(i))
+			if err != nil {
+				t.Fatalf("Error when removing value: %v", err)
+			}
+		}
+
+		for i := 0; i < count; i++ {
+			if i%2 == 0 {
+				expectNotFound(kv, keyFor(i), t)
+			} else {
+				expectValue(kv, keyFor(i), valueFor(i), t)
+			}
+		}
+	})
+
+	t.Run("Flush() and reopening preserve values", func(t *testing.T) {
+		kv, reopen := factory(t)
+		if reopen == nil {
+			t.Skip("Implementation does not persist values")
+		}
+
+		const count = 300
+
+		for i := 0; i < count; i++ {
+			put(kv, keyFor(i), valueFor(i), t)
+		}
+		for i := 0; i < count; i += 3 {
+			kv.Remove(keyFor(i))
+		}
+
+		err := kv.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing: %v", err)
+		}
+
+		kv, err = reopen()
+		if err != nil {
+			t.Fatalf("Error when reopening: %v", err)
+		}
+
+		for i := 0; i < count; i++ {
+			if i%3 == 0 {
+				expectNotFound(kv, keyFor(i), t)
+			} else {
+				expectValue(kv, keyFor(i), valueFor(i), t)
+			}
+		}
+	})
+
+	t.Run("Close() persists unflushed values", func(t *testing.T) {
+		kv, reopen := factory(t)
+		if reopen == nil {
+			t.Skip("Implementation does not persist values")
+		}
+
+		put(kv, "apple", conformanceValue{Name: "apple"}, t)
+
+		kv, err := reopen()
+		if err != nil {
+			t.Fatalf("Error when reopening: %v", err)
+		}
+
+		expectValue(kv, "apple", conformanceValue{Name: "apple"}, t)
+	})
+
+	t.Run("Close() causes subsequent operations to return ErrClosed", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		err := kv.Close()
+		if err != nil {
+			t.Fatalf("Error when closing: %v", err)
+		}
+
+		var result conformanceValue
+
+		if err := kv.Get("apple", &result); err != keva.ErrClosed {
+			t.Errorf("Expected ErrClosed from Get() but got %v", err)
+		}
+		if err := kv.Put("apple", result); err != keva.ErrClosed {
+			t.Errorf("Expected ErrClosed from Put() but got %v", err)
+		}
+		if err := kv.Remove("apple"); err != keva.ErrClosed {
+			t.Errorf("Expected ErrClosed from Remove() but got %v", err)
+		}
+	})
+
+	t.Run("Concurrent operations keep every value", func(t *testing.T) {
+		kv, _ := factory(t)
+
+		const writers = 8
+		const keysPerWriter = 100
+
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*2)
+
+		for w := 0; w < writers; w++ {
+			wg.Add(2)
+
+			go func(w int) {
+				defer wg.Done()
+
+				for i := w * keysPerWriter; i < (w+1)*keysPerWriter; i++ {
+					err := kv.Put(keyFor(i), valueFor(i))
+					if err == nil && i%10 == 0 {
+						err = kv.Remove(keyFor(i))
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(w)
+
+			go func(w int) {
+				defer wg.Done()
+
+				for i := 0; i < writers*keysPerWriter; i += writers {
+					var result conformanceValue
+
+					err := kv.Get(keyFor(i), &result)
+					if err != nil && err != keva.ErrValueNotFound {
+						errs <- err
+						return
+					}
+				}
+
+				if err := kv.Flush(); err != nil {
+					errs <- err
+				}
+			}(w)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatalf("Error during concurrent operations: %v", err)
+		}
+
+		for i := 0; i < writers*keysPerWriter; i++ {
+			if i%10 == 0 {
+				expectNotFound(kv, keyFor(i), t)
+			} else {
+				expectValue(kv, keyFor(i), valueFor(i), t)
+			}
+		}
+	})
+}
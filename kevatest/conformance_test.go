@@ -0,0 +1,75 @@
+package kevatest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mandykoh/keva"
+)
+
+func TestRunConformance(t *testing.T) {
+
+	storeFactory := func(opts ...keva.Option) Factory {
+		return func(t *testing.T) (keva.KeyValue, func() (keva.KeyValue, error)) {
+			rootPath, err := ioutil.TempDir("", "keva-conformance-test")
+			if err != nil {
+				t.Fatalf("Could not create temporary location for store: %v", err)
+			}
+			t.Cleanup(func() { os.RemoveAll(rootPath) })
+
+			s, err := keva.NewStore(rootPath, opts...)
+			if err != nil {
+				t.Fatalf("Could not create store: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+
+			reopen := func() (keva.KeyValue, error) {
+				err := s.Close()
+				if err != nil {
+					return nil, err
+				}
+
+				s, err = keva.NewStore(rootPath, opts...)
+				return s, err
+			}
+
+			return s, reopen
+		}
+	}
+
+	t.Run("Store", func(t *testing.T) {
+		RunConformance(t, storeFactory())
+	})
+
+	t.Run("Store with small buckets and cache", func(t *testing.T) {
+		RunConformance(t, storeFactory(keva.WithMaxObjectsPerBucket(4), keva.WithMaxBucketsCached(8)))
+	})
+
+	t.Run("Store with shared cache", func(t *testing.T) {
+		cache, err := keva.NewCache(16)
+		if err != nil {
+			t.Fatalf("Could not create cache: %v", err)
+		}
+
+		RunConformance(t, storeFactory(keva.WithCache(cache), keva.WithMaxObjectsPerBucket(8)))
+	})
+
+	t.Run("Store with alternative bucket layout", func(t *testing.T) {
+		RunConformance(t, storeFactory(keva.WithBucketPathSegmentLength(1), keva.WithHashFunction(keva.FNV1a128), keva.WithMaxObjectsPerBucket(4)))
+	})
+
+	t.Run("Store on FaultFS", func(t *testing.T) {
+		fs := NewFaultFS(LoseUnsyncedData)
+
+		RunConformance(t, func(t *testing.T) (keva.KeyValue, func() (keva.KeyValue, error)) {
+			return storeFactory(keva.WithFileSystem(fs), keva.WithMaxObjectsPerBucket(4))(t)
+		})
+	})
+
+	t.Run("MemoryStore", func(t *testing.T) {
+		RunConformance(t, func(t *testing.T) (keva.KeyValue, func() (keva.KeyValue, error)) {
+			return keva.NewMemoryStore(), nil
+		})
+	})
+}
@@ -0,0 +1,544 @@
+// Package kevatest provides tools for testing keva stores and other KeyValue
+// implementations, including a filesystem which can inject faults and
+// simulate power loss.
+package kevatest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mandykoh/keva"
+)
+
+// ErrPowerLoss is returned by every operation on a FaultFS after power has
+// been lost, until Crash is called.
+var ErrPowerLoss = errors.New("simulated power loss")
+
+// Op identifies a kind of filesystem operation, for deciding which to fail.
+type Op string
+
+const (
+	OpClose   Op = "close"
+	OpCreate  Op = "create"
+	OpMkdir   Op = "mkdir"
+	OpOpen    Op = "open"
+	OpRead    Op = "read"
+	OpReadDir Op = "readdir"
+	OpRemove  Op = "remove"
+	OpRename  Op = "rename"
+	OpStat    Op = "stat"
+	OpSync    Op = "sync"
+	OpWrite   Op = "write"
+)
+
+// PowerLossMode determines which changes a FaultFS loses when it crashes.
+type PowerLossMode int
+
+const (
+	// LoseUnsyncedData loses file contents written since each file was
+	// last synced. Creating, renaming and removing files and directories
+	// takes effect durably and atomically.
+	LoseUnsyncedData PowerLossMode = iota
+
+	// LoseUnsyncedDataAndRenames also loses any creation, rename or removal
+	// of a directory's entries since the directory was last synced, as a
+	// journalling filesystem such as ext4 or XFS may.
+	LoseUnsyncedDataAndRenames
+)
+
+// FaultFS is an in-memory keva.FileSystem which can fail operations on
+// demand and simulate power loss. The zero value is not usable; create one
+// with NewFaultFS.
+type FaultFS struct {
+	lock          sync.Mutex
+	mode          PowerLossMode
+	root          *faultFSNode
+	generation    int
+	fault         func(op Op, name string) error
+	opsUntilCrash int
+	poweredOff    bool
+}
+
+type faultFSNode struct {
+	isDir         bool
+	mode          os.FileMode
+	modTime       time.Time
+	data          []byte
+	syncedData    []byte
+	entries       map[string]*faultFSNode
+	syncedEntries map[string]*faultFSNode
+}
+
+// Crash simulates the machine restarting after a power loss, discarding
+// whatever changes the filesystem's PowerLossMode says were not yet durable.
+// Files opened before the crash can no longer be used, and any fault or
+// pending power loss is cleared.
+func (fs *FaultFS) Crash() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.root.crash()
+	fs.generation++
+	fs.fault = nil
+	fs.opsUntilCrash = 0
+	fs.poweredOff = false
+}
+
+func (fs *FaultFS) Create(name string, perm os.FileMode) (keva.File, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpCreate, name)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, base, err := fs.lookupParent("create", name)
+	if err != nil {
+		return nil, err
+	}
+
+	node := parent.entries[base]
+	if node == nil {
+		node = &faultFSNode{mode: perm}
+		fs.link(parent, base, node)
+	} else if node.isDir {
+		return nil, &os.PathError{Op: "create", Path: name, Err: errIsDir}
+	}
+
+	node.data = nil
+	node.modTime = time.Now()
+
+	return &faultFSFile{fs: fs, node: node, name: name, generation: fs.generation, writable: true}, nil
+}
+
+// LosePowerAfter makes every operation after the next n fail with
+// ErrPowerLoss, as if the machine had lost power, until Crash is called.
+func (fs *FaultFS) LosePowerAfter(n int) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.opsUntilCrash = n + 1
+}
+
+func (fs *FaultFS) Mkdir(name string, perm os.FileMode) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpMkdir, name)
+	if err != nil {
+		return err
+	}
+
+	parent, base, err := fs.lookupParent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if parent.entries[base] != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+
+	fs.link(parent, base, newFaultFSDir(perm))
+	return nil
+}
+
+func (fs *FaultFS) Open(name string) (keva.File, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpOpen, name)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := fs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &faultFSFile{fs: fs, node: node, name: name, generation: fs.generation}, nil
+}
+
+func (fs *FaultFS) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpReadDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := fs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.isDir {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	var result []os.FileInfo
+
+	for entryName, entry := range node.entries {
+		result = append(result, entry.info(entryName))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+func (fs *FaultFS) Remove(name string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpRemove, name)
+	if err != nil {
+		return err
+	}
+
+	parent, base, err := fs.lookupParent("remove", name)
+	if err != nil {
+		return err
+	}
+
+	node := parent.entries[base]
+	if node == nil {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if node.isDir && len(node.entries) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+
+	fs.unlink(parent, base)
+	return nil
+}
+
+func (fs *FaultFS) Rename(oldName, newName string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpRename, oldName)
+	if err != nil {
+		return err
+	}
+
+	oldParent, oldBase, err := fs.lookupParent("rename", oldName)
+	if err != nil {
+		return err
+	}
+
+	node := oldParent.entries[oldBase]
+	if node == nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+
+	newParent, newBase, err := fs.lookupParent("rename", newName)
+	if err != nil {
+		return err
+	}
+
+	if existing := newParent.entries[newBase]; existing != nil && existing != node {
+		switch {
+		case node.isDir && !existing.isDir:
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errNotDir}
+		case !node.isDir && existing.isDir:
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errIsDir}
+		case existing.isDir && len(existing.entries) > 0:
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errNotEmpty}
+		}
+	}
+
+	fs.unlink(oldParent, oldBase)
+	fs.link(newParent, newBase, node)
+	return nil
+}
+
+// SetFault makes the filesystem call fault before each operation, failing the
+// operation with the error it returns if that is not nil. Pass nil to stop
+// injecting faults.
+func (fs *FaultFS) SetFault(fault func(op Op, name string) error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.fault = fault
+}
+
+func (fs *FaultFS) Stat(name string) (os.FileInfo, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := fs.beginOp(OpStat, name)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := fs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.info(filepath.Base(name)), nil
+}
+
+func (fs *FaultFS) beginOp(op Op, name string) error {
+	if fs.opsUntilCrash > 0 {
+		fs.opsUntilCrash--
+		fs.poweredOff = fs.opsUntilCrash == 0
+	}
+	if fs.poweredOff {
+		return ErrPowerLoss
+	}
+
+	if fs.fault != nil {
+		return fs.fault(op, name)
+	}
+
+	return nil
+}
+
+func (fs *FaultFS) link(parent *faultFSNode, name string, node *faultFSNode) {
+	parent.entries[name] = node
+	parent.modTime = time.Now()
+
+	if fs.mode == LoseUnsyncedData {
+		parent.syncedEntries[name] = node
+	}
+}
+
+func (fs *FaultFS) lookup(op, name string) (*faultFSNode, error) {
+	node := fs.root
+
+	for _, segment := range splitPath(name) {
+		if !node.isDir {
+			return nil, &os.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+
+		node = node.entries[segment]
+		if node == nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+	}
+
+	return node, nil
+}
+
+func (fs *FaultFS) lookupParent(op, name string) (*faultFSNode, string, error) {
+	segments := splitPath(name)
+	if len(segments) == 0 {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+
+	parent, err := fs.lookup(op, filepath.Dir(filepath.Clean(name)))
+	if err != nil {
+		return nil, "", err
+	}
+	if !parent.isDir {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+
+	return parent, segments[len(segments)-1], nil
+}
+
+func (fs *FaultFS) unlink(parent *faultFSNode, name string) {
+	delete(parent.entries, name)
+	parent.modTime = time.Now()
+
+	if fs.mode == LoseUnsyncedData {
+		delete(parent.syncedEntries, name)
+	}
+}
+
+func (n *faultFSNode) crash() {
+	if !n.isDir {
+		n.data = append([]byte(nil), n.syncedData...)
+		return
+	}
+
+	n.entries = make(map[string]*faultFSNode)
+
+	for name, entry := range n.syncedEntries {
+		n.entries[name] = entry
+		entry.crash()
+	}
+}
+
+func (n *faultFSNode) info(name string) os.FileInfo {
+	fileInfo := faultFSFileInfo{
+		name:    name,
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+	if n.isDir {
+		fileInfo.mode |= os.ModeDir
+	}
+
+	return fileInfo
+}
+
+func (n *faultFSNode) sync() {
+	if !n.isDir {
+		n.syncedData = append([]byte(nil), n.data...)
+		return
+	}
+
+	n.syncedEntries = make(map[string]*faultFSNode)
+
+	for name, entry := range n.entries {
+		n.syncedEntries[name] = entry
+	}
+}
+
+// NewFaultFS returns an empty FaultFS which loses the changes described by
+// mode when it crashes.
+func NewFaultFS(mode PowerLossMode) *FaultFS {
+	return &FaultFS{
+		mode: mode,
+		root: newFaultFSDir(0700),
+	}
+}
+
+func newFaultFSDir(perm os.FileMode) *faultFSNode {
+	return &faultFSNode{
+		isDir:         true,
+		mode:          perm,
+		modTime:       time.Now(),
+		entries:       make(map[string]*faultFSNode),
+		syncedEntries: make(map[string]*faultFSNode),
+	}
+}
+
+func splitPath(name string) []string {
+	var segments []string
+
+	for _, segment := range strings.Split(filepath.ToSlash(filepath.Clean(name)), "/") {
+		if segment != "" && segment != "." {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+var (
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+	errNotEmpty = errors.New("directory not empty")
+	errClosed   = errors.New("file already closed")
+)
+
+type faultFSFile struct {
+	fs         *FaultFS
+	node       *faultFSNode
+	name       string
+	generation int
+	offset     int
+	writable   bool
+	closed     bool
+}
+
+func (f *faultFSFile) Close() error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	err := f.begin(OpClose)
+	if err != nil {
+		return err
+	}
+
+	f.closed = true
+	return nil
+}
+
+func (f *faultFSFile) Read(p []byte) (int, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	err := f.begin(OpRead)
+	if err != nil {
+		return 0, err
+	}
+	if f.node.isDir {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	if f.offset >= len(f.node.data) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *faultFSFile) Stat() (os.FileInfo, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	err := f.begin(OpStat)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *faultFSFile) Sync() error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	err := f.begin(OpSync)
+	if err != nil {
+		return err
+	}
+
+	f.node.sync()
+	return nil
+}
+
+func (f *faultFSFile) Write(p []byte) (int, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	err := f.begin(OpWrite)
+	if err != nil {
+		return 0, err
+	}
+	if !f.writable {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrPermission}
+	}
+
+	f.node.data = append(f.node.data[:f.offset], p...)
+	f.node.modTime = time.Now()
+	f.offset += len(p)
+	return len(p), nil
+}
+
+func (f *faultFSFile) begin(op Op) error {
+	if f.closed {
+		return &os.PathError{Op: string(op), Path: f.name, Err: errClosed}
+	}
+	if f.generation != f.fs.generation {
+		return ErrPowerLoss
+	}
+
+	return f.fs.beginOp(op, f.name)
+}
+
+type faultFSFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i faultFSFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i faultFSFileInfo) ModTime() time.Time { return i.modTime }
+func (i faultFSFileInfo) Mode() os.FileMode  { return i.mode }
+func (i faultFSFileInfo) Name() string       { return i.name }
+func (i faultFSFileInfo) Size() int64        { return i.size }
+func (i faultFSFileInfo) Sys() interface{}   { return nil }
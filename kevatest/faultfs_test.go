@@ -0,0 +1,166 @@
+package kevatest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFaultFS(t *testing.T) {
+
+	writeFile := func(fs *FaultFS, name, content string, sync bool, t *testing.T) {
+		file, err := fs.Create(name, 0600)
+		if err != nil {
+			t.Fatalf("Error when creating file: %v", err)
+		}
+
+		_, err = file.Write([]byte(content))
+		if err != nil {
+			t.Fatalf("Error when writing file: %v", err)
+		}
+
+		if sync {
+			err = file.Sync()
+			if err != nil {
+				t.Fatalf("Error when syncing file: %v", err)
+			}
+		}
+
+		err = file.Close()
+		if err != nil {
+			t.Fatalf("Error when closing file: %v", err)
+		}
+	}
+
+	readFile := func(fs *FaultFS, name string) (string, error) {
+		file, err := fs.Open(name)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		content, err := ioutil.ReadAll(file)
+		return string(content), err
+	}
+
+	syncDir := func(fs *FaultFS, name string, t *testing.T) {
+		dir, err := fs.Open(name)
+		if err != nil {
+			t.Fatalf("Error when opening directory: %v", err)
+		}
+		defer dir.Close()
+
+		err = dir.Sync()
+		if err != nil {
+			t.Fatalf("Error when syncing directory: %v", err)
+		}
+	}
+
+	t.Run("Crash() loses unsynced file contents", func(t *testing.T) {
+		fs := NewFaultFS(LoseUnsyncedData)
+
+		writeFile(fs, "/synced", "apple", true, t)
+		writeFile(fs, "/unsynced", "banana", false, t)
+
+		fs.Crash()
+
+		if content, err := readFile(fs, "/synced"); err != nil || content != "apple" {
+			t.Errorf("Expected synced file to contain 'apple' but got '%s' (%v)", content, err)
+		}
+		if content, err := readFile(fs, "/unsynced"); err != nil || content != "" {
+			t.Errorf("Expected unsynced file to be empty but got '%s' (%v)", content, err)
+		}
+	})
+
+	t.Run("Crash() keeps renames when only unsynced data is lost", func(t *testing.T) {
+		fs := NewFaultFS(LoseUnsyncedData)
+
+		writeFile(fs, "/old", "apple", true, t)
+		fs.Rename("/old", "/new")
+
+		fs.Crash()
+
+		if _, err := fs.Stat("/old"); !os.IsNotExist(err) {
+			t.Errorf("Expected old name to be gone but got %v", err)
+		}
+		if content, err := readFile(fs, "/new"); err != nil || content != "apple" {
+			t.Errorf("Expected renamed file to contain 'apple' but got '%s' (%v)", content, err)
+		}
+	})
+
+	t.Run("Crash() loses renames into unsynced directories", func(t *testing.T) {
+		fs := NewFaultFS(LoseUnsyncedDataAndRenames)
+
+		fs.Mkdir("/dir", 0700)
+		syncDir(fs, "/", t)
+
+		writeFile(fs, "/dir/old", "apple", true, t)
+		syncDir(fs, "/dir", t)
+
+		fs.Rename("/dir/old", "/dir/new")
+		writeFile(fs, "/dir/other", "banana", true, t)
+		fs.Mkdir("/unsynced", 0700)
+
+		fs.Crash()
+
+		if content, err := readFile(fs, "/dir/old"); err != nil || content != "apple" {
+			t.Errorf("Expected rename to be lost but got '%s' (%v)", content, err)
+		}
+		if _, err := fs.Stat("/dir/new"); !os.IsNotExist(err) {
+			t.Errorf("Expected new name to be lost but got %v", err)
+		}
+		if _, err := fs.Stat("/dir/other"); !os.IsNotExist(err) {
+			t.Errorf("Expected unsynced file creation to be lost but got %v", err)
+		}
+		if _, err := fs.Stat("/unsynced"); !os.IsNotExist(err) {
+			t.Errorf("Expected unsynced directory to be lost but got %v", err)
+		}
+	})
+
+	t.Run("LosePowerAfter() fails operations until Crash()", func(t *testing.T) {
+		fs := NewFaultFS(LoseUnsyncedData)
+
+		fs.LosePowerAfter(1)
+
+		if err := fs.Mkdir("/a", 0700); err != nil {
+			t.Fatalf("Expected first operation to succeed but got %v", err)
+		}
+		if err := fs.Mkdir("/b", 0700); err != ErrPowerLoss {
+			t.Errorf("Expected ErrPowerLoss but got %v", err)
+		}
+		if _, err := fs.Stat("/a"); err != ErrPowerLoss {
+			t.Errorf("Expected ErrPowerLoss but got %v", err)
+		}
+
+		fs.Crash()
+
+		if _, err := fs.Stat("/a"); err != nil {
+			t.Errorf("Expected operations to succeed after crash but got %v", err)
+		}
+	})
+
+	t.Run("SetFault() fails chosen operations", func(t *testing.T) {
+		fs := NewFaultFS(LoseUnsyncedData)
+		injected := errors.New("injected")
+
+		fs.SetFault(func(op Op, name string) error {
+			if op == OpRename {
+				return injected
+			}
+			return nil
+		})
+
+		writeFile(fs, "/old", "apple", true, t)
+
+		if err := fs.Rename("/old", "/new"); err != injected {
+			t.Errorf("Expected injected error but got %v", err)
+		}
+
+		fs.SetFault(nil)
+
+		if err := fs.Rename("/old", "/new"); err != nil {
+			t.Errorf("Expected rename to succeed but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package kevatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/mandykoh/keva"
+)
+
+// CrashWorkload configures RunCrashWorkload.
+type CrashWorkload struct {
+
+	// Seed seeds the random choice of operations and crash points, so that
+	// a failing workload can be reproduced.
+	Seed int64
+
+	// Crashes is the number of times power is lost.
+	Crashes int
+
+	// OperationsPerCrash is the largest number of store operations run
+	// between crashes.
+	OperationsPerCrash int
+
+	// Keys is the number of distinct keys written.
+	Keys int
+
+	// Options are used to open the store, along with keva.WithFileSystem.
+	// The store must use keva.JSONCodec.
+	Options []keva.Option
+}
+
+type workloadState struct {
+	present bool
+	value   string
+}
+
+// RunCrashWorkload runs randomized Put, Remove, Get, Flush, Compact and
+// ReshardOnline operations against a store at rootPath on fs, losing power at
+// random points. After every crash the store is reopened and its invariants
+// are checked:
+//
+//   - the store opens successfully;
+//   - no flushed change has been lost, so every key holds either the value
+//     it had when the store was last flushed, or one written since;
+//   - no key is stored in more than one bucket, and every stored key can be
+//     retrieved with Get;
+//   - if the store has a key index, it lists exactly the stored keys.
+func RunCrashWorkload(t testing.TB, fs *FaultFS, rootPath string, w CrashWorkload) {
+	t.Helper()
+
+	rng := rand.New(rand.NewSource(w.Seed))
+	opts := append(append([]keva.Option(nil), w.Options...), keva.WithFileSystem(fs))
+
+	s, err := keva.NewStore(rootPath, opts...)
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+
+	// Every key may hold any of the states it has been given since the store
+	// was last flushed, or it last crashed.
+
+	current := make(map[string]workloadState)
+	acceptable := make(map[string][]workloadState)
+
+	for i := 0; i < w.Keys; i++ {
+		acceptable[fmt.Sprintf("key%d", i)] = []workloadState{{}}
+	}
+
+	for crash := 0; crash < w.Crashes; crash++ {
+		fs.LosePowerAfter(rng.Intn(w.OperationsPerCrash * 8))
+
+		for op := 0; op < w.OperationsPerCrash; op++ {
+			key := fmt.Sprintf("key%d", rng.Intn(w.Keys))
+
+			var err error
+
+			switch n := rng.Intn(21); {
+			case n < 12:
+				state := workloadState{present: true, value: fmt.Sprintf("value-%d-%d", crash, op)}
+				acceptable[key] = append(acceptable[key], state)
+				current[key] = state
+
+				err = s.Put(key, state.value)
+
+			case n < 16:
+				state := workloadState{}
+				acceptable[key] = append(acceptable[key], state)
+				current[key] = state
+
+				err = s.Remove(key)
+
+			case n < 18:
+				var actual workloadState
+
+				actual, err = getState(s, key)
+				if err == nil && actual != current[key] {
+					t.Fatalf("Seed %d, crash %d: expected %s to be %+v but got %+v", w.Seed, crash, key, current[key], actual)
+				}
+
+			case n < 20:
+				if n == 18 {
+					err = s.Flush()
+				} else {
+					err = s.Compact()
+				}
+				if err == nil {
+					for key, state := range current {
+						acceptable[key] = []workloadState{state}
+					}
+				}
+
+			default:
+				// Resharding saves only the buckets it rewrites, so leaves
+				// the acceptable states as they are.
+
+				err = s.ReshardOnline(context.Background(), keva.SplitPolicy{MaxObjects: 1 + rng.Intn(8)}, nil)
+			}
+
+			if errors.Is(err, ErrPowerLoss) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Seed %d, crash %d: unexpected error: %v", w.Seed, crash, err)
+			}
+		}
+
+		fs.Crash()
+
+		s, err = keva.NewStore(rootPath, opts...)
+		if err != nil {
+			t.Fatalf("Seed %d, crash %d: could not reopen store: %v", w.Seed, crash, err)
+		}
+
+		checkCrashInvariants(t, s, w, crash, acceptable)
+
+		for key := range acceptable {
+			actual, _ := getState(s, key)
+			current[key] = actual
+			acceptable[key] = []workloadState{actual}
+		}
+	}
+
+	err = s.Close()
+	if err != nil {
+		t.Fatalf("Error when closing store: %v", err)
+	}
+}
+
+func checkCrashInvariants(t testing.TB, s *keva.Store, w CrashWorkload, crash int, acceptable map[string][]workloadState) {
+	t.Helper()
+
+	var exported bytes.Buffer
+
+	err := s.Export(&exported)
+	if err != nil {
+		t.Fatalf("Seed %d, crash %d: error when exporting store: %v", w.Seed, crash, err)
+	}
+
+	stored := make(map[string]bool)
+	decoder := json.NewDecoder(&exported)
+
+	for decoder.More() {
+		var record struct {
+			Key string `json:"key"`
+		}
+
+		err = decoder.Decode(&record)
+		if err != nil {
+			t.Fatalf("Seed %d, crash %d: error when reading export: %v", w.Seed, crash, err)
+		}
+		if stored[record.Key] {
+			t.Fatalf("Seed %d, crash %d: %s is stored in more than one bucket", w.Seed, crash, record.Key)
+		}
+
+		stored[record.Key] = true
+	}
+
+	indexed := make(map[string]bool)
+
+	for key, err := range s.Range("", "") {
+		if errors.Is(err, keva.ErrNoKeyIndex) {
+			indexed = stored
+			break
+		}
+		if err != nil {
+			t.Fatalf("Seed %d, crash %d: error when scanning key index: %v", w.Seed, crash, err)
+		}
+
+		indexed[key] = true
+	}
+
+	for i := 0; i < w.Keys; i++ {
+		key := fmt.Sprintf("key%d", i)
+
+		actual, err := getState(s, key)
+		if err != nil {
+			t.Fatalf("Seed %d, crash %d: error when retrieving %s: %v", w.Seed, crash, key, err)
+		}
+		if actual.present != stored[key] {
+			t.Fatalf("Seed %d, crash %d: %s is stored but can't be retrieved", w.Seed, crash, key)
+		}
+		if indexed[key] != stored[key] {
+			t.Fatalf("Seed %d, crash %d: expected %s to be indexed %v but got %v", w.Seed, crash, key, stored[key], indexed[key])
+		}
+
+		states := acceptable[key]
+
+		found := false
+		for _, state := range states {
+			if state == actual {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Fatalf("Seed %d, crash %d: expected %s to be one of %+v after crash but got %+v", w.Seed, crash, key, states, actual)
+		}
+	}
+}
+
+func getState(s *keva.Store, key string) (workloadState, error) {
+	var state workloadState
+
+	err := s.Get(key, &state.value)
+	if err == keva.ErrValueNotFound {
+		return workloadState{}, nil
+	}
+
+	state.present = err == nil
+	return state, err
+}
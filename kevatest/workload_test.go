@@ -0,0 +1,72 @@
+package kevatest
+
+import (
+	"testing"
+
+	"github.com/mandykoh/keva"
+)
+
+func TestRunCrashWorkload(t *testing.T) {
+
+	t.Run("Store keeps flushed changes when unsynced data is lost", func(t *testing.T) {
+		for seed := int64(1); seed <= 20; seed++ {
+			RunCrashWorkload(t, NewFaultFS(LoseUnsyncedData), "/store", CrashWorkload{
+				Seed:               seed,
+				Crashes:            20,
+				OperationsPerCrash: 100,
+				Keys:               60,
+				Options: []keva.Option{
+					keva.WithMaxObjectsPerBucket(4),
+					keva.WithMaxBucketsCached(4),
+				},
+			})
+		}
+	})
+
+	t.Run("Store keeps flushed changes across bucket splits and merges", func(t *testing.T) {
+		for seed := int64(1); seed <= 20; seed++ {
+			RunCrashWorkload(t, NewFaultFS(LoseUnsyncedData), "/store", CrashWorkload{
+				Seed:               seed,
+				Crashes:            20,
+				OperationsPerCrash: 100,
+				Keys:               300,
+				Options: []keva.Option{
+					keva.WithMaxObjectsPerBucket(2),
+					keva.WithMaxBucketsCached(4),
+				},
+			})
+		}
+	})
+
+	t.Run("Store keeps its key index consistent with its buckets", func(t *testing.T) {
+		for seed := int64(1); seed <= 20; seed++ {
+			RunCrashWorkload(t, NewFaultFS(LoseUnsyncedData), "/store", CrashWorkload{
+				Seed:               seed,
+				Crashes:            20,
+				OperationsPerCrash: 100,
+				Keys:               60,
+				Options: []keva.Option{
+					keva.WithKeyIndex(),
+					keva.WithMaxObjectsPerBucket(4),
+					keva.WithMaxBucketsCached(4),
+				},
+			})
+		}
+	})
+
+	t.Run("Store keeps flushed changes when unsynced renames are lost", func(t *testing.T) {
+		for seed := int64(1); seed <= 20; seed++ {
+			RunCrashWorkload(t, NewFaultFS(LoseUnsyncedDataAndRenames), "/store", CrashWorkload{
+				Seed:               seed,
+				Crashes:            20,
+				OperationsPerCrash: 100,
+				Keys:               60,
+				Options: []keva.Option{
+					keva.WithMaxObjectsPerBucket(4),
+					keva.WithMaxBucketsCached(4),
+					keva.WithSyncMode(keva.SyncDirectories),
+				},
+			})
+		}
+	})
+}
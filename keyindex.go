@@ -0,0 +1,859 @@
+package keva
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const keyIndexDirName = "keva.index"
+
+// maxKeyIndexLogRecords is the number of committed changes a key index log
+// holds before they are rolled into a sorted run.
+const maxKeyIndexLogRecords = 4096
+
+// ErrNoKeyIndex indicates that keys were scanned in a store opened without
+// WithKeyIndex.
+var ErrNoKeyIndex = errors.New("store has no key index")
+
+// Range returns an iterator over the keys from start up to but not including
+// end, in ascending byte order, or over all keys from start if end is empty.
+// The store must have been opened WithKeyIndex, or ErrNoKeyIndex is yielded.
+// Keys belonging to namespaces are not included.
+//
+// The keys are those in the store when iteration begins, so the store may be
+// modified during iteration.
+func (s *Store) Range(start, end string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		keys, err := s.keyIterator(start, end)
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		for key, ok := keys.Next(); ok; key, ok = keys.Next() {
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Scan returns an iterator over the keys beginning with prefix, in ascending
+// byte order. See Range.
+func (s *Store) Scan(prefix string) iter.Seq2[string, error] {
+	return s.Range(prefix, prefixEnd(prefix))
+}
+
+// changeKey applies a change to key in bucket, recording in the key index
+// whether the key is present afterwards if that has changed.
+func (s *Store) changeKey(b *bucket, key string, present bool, apply func()) {
+	if _, exists := b.objects[key]; s.keyIndex == nil || exists == present {
+		apply()
+		return
+	}
+
+	s.keyIndex.Change(key, present, apply)
+}
+
+// hasKey indicates whether key is stored, for verifying changes in a key index
+// log which may not have reached their buckets.
+func (s *Store) hasKey(key string) (bool, error) {
+	_, err := s.getEncoded(context.Background(), key)
+	if err == ErrValueNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *Store) keyIterator(start, end string) (*keyIndexIterator, error) {
+	err := s.beginOperation()
+	if err != nil {
+		return nil, err
+	}
+	defer s.endOperation()
+
+	if s.keyIndex == nil {
+		return nil, ErrNoKeyIndex
+	}
+
+	return s.keyIndex.Iterator(start, end), nil
+}
+
+// keyIndex holds every key in a store in sorted order, for Scan and Range.
+//
+// Keys are kept in immutable sorted runs, oldest first, each of which records
+// the keys added and removed by the changes rolled into it; the oldest run
+// lists every key and records no removals. Changes since the newest run are
+// held in memory, and appended to a log when the store is flushed. Once the
+// log holds enough committed changes, they are rolled into a new run, and
+// runs are merged whenever the newest is at least half the size of the one
+// before, so that there are only logarithmically many.
+//
+// Changes are written to the log before any bucket holding them is saved.
+// Each flush then appends a commit, recording that the changes logged before
+// it have all been saved to their buckets. When the store is opened, the
+// changes logged after the last commit of each log are checked against the
+// buckets, as a crash may have left them out of step.
+type keyIndex struct {
+	updating      sync.RWMutex
+	lock          sync.Mutex
+	absDirPath    string
+	runs          []keyIndexRun
+	changes       map[string]bool
+	pending       []keyIndexEntry
+	log           File
+	logSeq        int
+	logged        []keyIndexEntry
+	committed     int
+	maxLogRecords int
+	failure       error
+}
+
+// keyIndexEntry records that a key was added, or removed.
+type keyIndexEntry struct {
+	key     string
+	removed bool
+}
+
+// keyIndexRecord is a line of a key index file: an entry, or in logs, a
+// commit of the first Commit entries of the log.
+type keyIndexRecord struct {
+	Key     string `json:"key"`
+	Removed bool   `json:"removed,omitempty"`
+	Commit  int    `json:"commit,omitempty"`
+}
+
+// keyIndexRun is a sorted run of entries rolled from the logs numbered first
+// to last.
+type keyIndexRun struct {
+	first   int
+	last    int
+	entries []keyIndexEntry
+}
+
+// Change records whether key is present, and calls apply to make the same
+// change to the key's bucket. Checkpoints are held off until both are done,
+// so that the buckets saved after a checkpoint hold every change it covers.
+func (x *keyIndex) Change(key string, present bool, apply func()) {
+	x.updating.RLock()
+	defer x.updating.RUnlock()
+
+	x.lock.Lock()
+	x.changes[key] = present
+	x.pending = append(x.pending, keyIndexEntry{key: key, removed: !present})
+	x.lock.Unlock()
+
+	apply()
+}
+
+// Checkpoint logs every change made so far, and returns the position in the
+// log which a commit must cover once the store's buckets have been saved.
+func (x *keyIndex) Checkpoint(storage *bucketStorage) (int, error) {
+	x.updating.Lock()
+	defer x.updating.Unlock()
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	err := x.writePendingLocked(storage)
+	return len(x.logged), err
+}
+
+// Close closes the log.
+func (x *keyIndex) Close() error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.log == nil {
+		return nil
+	}
+
+	err := x.log.Close()
+	x.log = nil
+	return err
+}
+
+// Commit records that the changes logged before position have been saved to
+// their buckets, rolling them into a new run if enough have accumulated.
+func (x *keyIndex) Commit(storage *bucketStorage, position int) error {
+	x.lock.Lock()
+
+	if position <= x.committed {
+		x.lock.Unlock()
+		return nil
+	}
+
+	err := x.appendLocked(storage, []keyIndexRecord{{Commit: position}})
+	if err == nil {
+		x.committed = position
+	}
+
+	x.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return x.rollIfNeeded(storage)
+}
+
+// Iterator returns an iterator over the keys from start up to but not
+// including end, or all keys from start if end is empty.
+func (x *keyIndex) Iterator(start, end string) *keyIndexIterator {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	sources := make([][]keyIndexEntry, 0, len(x.runs)+1)
+	for _, run := range x.runs {
+		sources = append(sources, run.entries)
+	}
+
+	var changes []keyIndexEntry
+
+	for key, present := range x.changes {
+		if key >= start && (end == "" || key < end) {
+			changes = append(changes, keyIndexEntry{key: key, removed: !present})
+		}
+	}
+
+	sortKeyIndexEntries(changes)
+
+	it := &keyIndexIterator{
+		sources:   append(sources, changes),
+		positions: make([]int, len(sources)+1),
+		end:       end,
+	}
+	it.seek(start)
+
+	return it
+}
+
+// WritePending logs any changes made since the log was last written, so that
+// they are logged before any bucket holding them is saved.
+func (x *keyIndex) WritePending(storage *bucketStorage) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	return x.writePendingLocked(storage)
+}
+
+func (x *keyIndex) appendLocked(storage *bucketStorage, records []keyIndexRecord) error {
+	if x.failure != nil {
+		return x.failure
+	}
+
+	err := writeKeyIndexRecords(storage, x.log, records)
+	if err != nil {
+		// A partly written record would hide any written after it.
+
+		x.failure = fmt.Errorf("key index log could not be written: %w", err)
+	}
+
+	return err
+}
+
+// load reads the index's runs and logs, verifying against the store's
+// buckets any logged changes which were not committed. It returns the names
+// of files which are no longer needed once the index has been written afresh,
+// and the highest log sequence number in use.
+func (x *keyIndex) load(storage *bucketStorage, hasKey func(string) (bool, error)) (obsolete []string, maxSeq int, err error) {
+	entries, err := storage.ReadDir(x.absDirPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var runs []keyIndexRun
+	var logSeqs []int
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if first, last, ok := parseKeyIndexRunName(name); ok {
+			runs = append(runs, keyIndexRun{first: first, last: last})
+		} else if seq, ok := parseKeyIndexLogName(name); ok {
+			logSeqs = append(logSeqs, seq)
+		} else {
+			obsolete = append(obsolete, name)
+		}
+	}
+
+	// Runs merged into another which was saved before a crash are covered
+	// by it, as are logs rolled into a saved run.
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].first < runs[j].first || runs[i].first == runs[j].first && runs[i].last > runs[j].last
+	})
+
+	covered := -1
+
+	for _, run := range runs {
+		if run.first <= covered {
+			obsolete = append(obsolete, run.fileName())
+			continue
+		}
+
+		records, err := readKeyIndexFile(storage, filepath.Join(x.absDirPath, run.fileName()), false)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, record := range records {
+			run.entries = append(run.entries, keyIndexEntry{key: record.Key, removed: record.Removed})
+		}
+
+		x.runs = append(x.runs, run)
+		covered = run.last
+	}
+
+	maxSeq = covered
+	verify := make(map[string]bool)
+
+	sort.Ints(logSeqs)
+
+	for _, seq := range logSeqs {
+		obsolete = append(obsolete, keyIndexLogName(seq))
+
+		if seq <= covered {
+			continue
+		}
+
+		maxSeq = seq
+
+		records, err := readKeyIndexFile(storage, filepath.Join(x.absDirPath, keyIndexLogName(seq)), true)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		committed := 0
+		for _, record := range records {
+			if record.Commit > 0 {
+				committed = record.Commit
+			}
+		}
+
+		position := 0
+		for _, record := range records {
+			if record.Commit > 0 {
+				continue
+			}
+
+			x.changes[record.Key] = !record.Removed
+
+			if position >= committed {
+				verify[record.Key] = true
+			}
+			position++
+		}
+	}
+
+	for key := range verify {
+		x.changes[key], err = hasKey(key)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return obsolete, maxSeq, nil
+}
+
+// mergeRuns merges the newest run into the one before it for as long as it
+// is at least half its size.
+func (x *keyIndex) mergeRuns(storage *bucketStorage) error {
+	for {
+		// Runs are only replaced by commits, which the store serializes,
+		// so can be merged without holding the lock.
+
+		x.lock.Lock()
+		runs := x.runs
+		x.lock.Unlock()
+
+		n := len(runs)
+		if n < 2 || len(runs[n-1].entries)*2 < len(runs[n-2].entries) {
+			return nil
+		}
+
+		merged := mergeKeyIndexRuns(runs[n-2], runs[n-1])
+
+		err := saveKeyIndexRun(storage, x.absDirPath, merged)
+		if err != nil {
+			return x.fail(err)
+		}
+
+		x.lock.Lock()
+		x.runs = append(append([]keyIndexRun(nil), runs[:n-2]...), merged)
+		x.lock.Unlock()
+
+		for _, run := range runs[n-2:] {
+			err = storage.Remove(filepath.Join(x.absDirPath, run.fileName()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+}
+
+// fail stops the index from being written any further after an error which
+// leaves its files inconsistent, until the store is reopened.
+func (x *keyIndex) fail(err error) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.failure == nil {
+		x.failure = fmt.Errorf("key index could not be saved: %w", err)
+	}
+
+	return err
+}
+
+// rebuild builds the index from the store's buckets, saving it as a single
+// run unless readOnly is set.
+func (x *keyIndex) rebuild(storage *bucketStorage, readOnly bool) error {
+	var entries []keyIndexEntry
+
+	err := walkBucketFiles(storage, storage.rootPath, func(absFilePath string) error {
+		objects, err := loadObjects(storage, absFilePath)
+		for key := range objects {
+			entries = append(entries, keyIndexEntry{key: key})
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	sortKeyIndexEntries(entries)
+
+	x.runs = []keyIndexRun{{entries: entries}}
+
+	if readOnly {
+		return nil
+	}
+
+	// The index is built alongside and moved into place, so that it is
+	// either complete or rebuilt again after a crash.
+
+	absTempPath := x.absDirPath + splitSuffix
+
+	err = storage.RemoveAll(absTempPath)
+	if err == nil {
+		err = storage.Mkdir(absTempPath)
+	}
+	if err == nil {
+		err = saveKeyIndexRun(storage, absTempPath, x.runs[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	return storage.Rename(absTempPath, x.absDirPath)
+}
+
+// rollLocked starts a new log holding the uncommitted changes of the current
+// one, and rolls the committed changes into a new run. It returns the run,
+// which has yet to be saved, and the sequence number of the replaced log.
+func (x *keyIndex) rollLocked(storage *bucketStorage) (keyIndexRun, int, error) {
+	if x.failure != nil {
+		return keyIndexRun{}, 0, x.failure
+	}
+
+	carried := append([]keyIndexEntry(nil), x.logged[x.committed:]...)
+
+	log, err := createKeyIndexLog(storage, x.absDirPath, x.logSeq+1, carried, 0)
+	if err != nil {
+		return keyIndexRun{}, 0, err
+	}
+
+	x.log.Close()
+
+	run := newKeyIndexRun(x.logSeq, x.logSeq, x.logged[:x.committed])
+	oldSeq := x.logSeq
+
+	x.runs = append(append([]keyIndexRun(nil), x.runs...), run)
+	x.log = log
+	x.logSeq++
+	x.logged = carried
+	x.committed = 0
+	x.changes = make(map[string]bool)
+
+	for _, entries := range [][]keyIndexEntry{x.logged, x.pending} {
+		for _, entry := range entries {
+			x.changes[entry.key] = !entry.removed
+		}
+	}
+
+	return run, oldSeq, nil
+}
+
+func (x *keyIndex) rollIfNeeded(storage *bucketStorage) error {
+	x.lock.Lock()
+
+	if x.committed < x.maxLogRecords {
+		x.lock.Unlock()
+		return nil
+	}
+
+	run, oldSeq, err := x.rollLocked(storage)
+	x.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// The replaced log remains until the run is saved, and a later run
+	// would cover the log if this one were missing.
+
+	err = saveKeyIndexRun(storage, x.absDirPath, run)
+	if err != nil {
+		return x.fail(err)
+	}
+
+	err = storage.Remove(filepath.Join(x.absDirPath, keyIndexLogName(oldSeq)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return x.mergeRuns(storage)
+}
+
+// startLog starts a log numbered seq holding every change not yet in a run,
+// all of which are known to match the store's buckets, then removes the
+// given obsolete files.
+func (x *keyIndex) startLog(storage *bucketStorage, seq int, obsolete []string) error {
+	entries := make([]keyIndexEntry, 0, len(x.changes))
+	for key, present := range x.changes {
+		entries = append(entries, keyIndexEntry{key: key, removed: !present})
+	}
+
+	sortKeyIndexEntries(entries)
+
+	log, err := createKeyIndexLog(storage, x.absDirPath, seq, entries, len(entries))
+	if err != nil {
+		return err
+	}
+
+	x.log = log
+	x.logSeq = seq
+	x.logged = entries
+	x.committed = len(entries)
+
+	for _, name := range obsolete {
+		err = storage.RemoveAll(filepath.Join(x.absDirPath, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.rollIfNeeded(storage)
+}
+
+func (x *keyIndex) writePendingLocked(storage *bucketStorage) error {
+	if len(x.pending) == 0 {
+		return nil
+	}
+
+	records := make([]keyIndexRecord, len(x.pending))
+	for i, entry := range x.pending {
+		records[i] = keyIndexRecord{Key: entry.key, Removed: entry.removed}
+	}
+
+	err := x.appendLocked(storage, records)
+	if err != nil {
+		return err
+	}
+
+	x.logged = append(x.logged, x.pending...)
+	x.pending = nil
+	return nil
+}
+
+func (r keyIndexRun) fileName() string {
+	return fmt.Sprintf("run-%010d-%010d", r.first, r.last)
+}
+
+// keyIndexIterator merges the runs of a key index, and the changes made since
+// them, into a single ascending sequence of keys.
+type keyIndexIterator struct {
+	sources   [][]keyIndexEntry
+	positions []int
+	end       string
+}
+
+// Next returns the next key, or false once there are no more.
+func (it *keyIndexIterator) Next() (string, bool) {
+	for {
+		key, found := "", false
+
+		for i, source := range it.sources {
+			if p := it.positions[i]; p < len(source) && (!found || source[p].key < key) {
+				key, found = source[p].key, true
+			}
+		}
+
+		if !found || it.end != "" && key >= it.end {
+			return "", false
+		}
+
+		if isReservedKey(key) {
+			it.seek(prefixEnd(namespaceKeyPrefix))
+			continue
+		}
+
+		// Later sources hold later changes, so take precedence.
+
+		removed := false
+
+		for i, source := range it.sources {
+			if p := it.positions[i]; p < len(source) && source[p].key == key {
+				removed = source[p].removed
+				it.positions[i]++
+			}
+		}
+
+		if !removed {
+			return key, true
+		}
+	}
+}
+
+func (it *keyIndexIterator) seek(key string) {
+	for i, source := range it.sources {
+		it.positions[i] = sort.Search(len(source), func(j int) bool {
+			return source[j].key >= key
+		})
+	}
+}
+
+func createKeyIndexLog(storage *bucketStorage, absDirPath string, seq int, entries []keyIndexEntry, commit int) (File, error) {
+	records := make([]keyIndexRecord, 0, len(entries)+1)
+	for _, entry := range entries {
+		records = append(records, keyIndexRecord{Key: entry.key, Removed: entry.removed})
+	}
+	if commit > 0 {
+		records = append(records, keyIndexRecord{Commit: commit})
+	}
+
+	file, err := storage.CreateFile(filepath.Join(absDirPath, keyIndexLogName(seq)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeKeyIndexRecords(storage, file, records)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func keyIndexLogName(seq int) string {
+	return fmt.Sprintf("log-%010d", seq)
+}
+
+// mergeKeyIndexRuns merges two adjacent runs, with entries of the newer
+// taking precedence. Removals are dropped if the older run is the oldest, as
+// there is then nothing left for them to remove keys from.
+func mergeKeyIndexRuns(older, newer keyIndexRun) keyIndexRun {
+	merged := keyIndexRun{
+		first:   older.first,
+		last:    newer.last,
+		entries: make([]keyIndexEntry, 0, len(older.entries)+len(newer.entries)),
+	}
+
+	keepRemovals := older.first != 0
+
+	for i, j := 0, 0; i < len(older.entries) || j < len(newer.entries); {
+		var entry keyIndexEntry
+
+		switch {
+		case j == len(newer.entries) || i < len(older.entries) && older.entries[i].key < newer.entries[j].key:
+			entry = older.entries[i]
+			i++
+
+		case i == len(older.entries) || newer.entries[j].key < older.entries[i].key:
+			entry = newer.entries[j]
+			j++
+
+		default:
+			entry = newer.entries[j]
+			i++
+			j++
+		}
+
+		if keepRemovals || !entry.removed {
+			merged.entries = append(merged.entries, entry)
+		}
+	}
+
+	return merged
+}
+
+// openKeyIndex loads the key index of the store in storage, or rebuilds it
+// from the store's buckets if it does not exist. Logged changes which were
+// not committed are verified with hasKey. Unless readOnly is set, a new log
+// is started and files no longer needed are removed.
+func openKeyIndex(storage *bucketStorage, readOnly bool, hasKey func(string) (bool, error)) (*keyIndex, error) {
+	x := newKeyIndex(filepath.Join(storage.rootPath, keyIndexDirName))
+
+	obsolete, maxSeq, err := x.load(storage, hasKey)
+	if os.IsNotExist(err) {
+		x = newKeyIndex(x.absDirPath)
+		obsolete, maxSeq = nil, 0
+		err = x.rebuild(storage, readOnly)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !readOnly {
+		err = x.startLog(storage, maxSeq+1, obsolete)
+		if err != nil {
+			x.Close()
+			return nil, err
+		}
+	}
+
+	return x, nil
+}
+
+func parseKeyIndexLogName(name string) (seq int, ok bool) {
+	_, err := fmt.Sscanf(name, "log-%d", &seq)
+	return seq, err == nil && name == keyIndexLogName(seq)
+}
+
+func parseKeyIndexRunName(name string) (first, last int, ok bool) {
+	_, err := fmt.Sscanf(name, "run-%d-%d", &first, &last)
+	return first, last, err == nil && name == (keyIndexRun{first: first, last: last}).fileName()
+}
+
+// prefixEnd returns the least string greater than every string beginning
+// with prefix, or an empty string if there is none.
+func prefixEnd(prefix string) string {
+	end := strings.TrimRight(prefix, "\xff")
+	if end == "" {
+		return ""
+	}
+
+	return end[:len(end)-1] + string([]byte{end[len(end)-1] + 1})
+}
+
+// readKeyIndexFile reads the records of a key index file. Logs may end with
+// a partly written record, which is ignored along with anything after it.
+func readKeyIndexFile(storage *bucketStorage, absFilePath string, isLog bool) ([]keyIndexRecord, error) {
+	content, err := storage.ReadFile(absFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []keyIndexRecord
+
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		var record keyIndexRecord
+
+		err = json.Unmarshal(line, &record)
+		if err != nil || !bytes.HasSuffix(line, []byte("\n")) {
+			if isLog || len(line) == 0 {
+				break
+			}
+			return nil, fmt.Errorf("key index file '%s' is corrupt", filepath.Base(absFilePath))
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func saveKeyIndexRun(storage *bucketStorage, absDirPath string, run keyIndexRun) error {
+	absFilePath := filepath.Join(absDirPath, run.fileName())
+
+	records := make([]keyIndexRecord, len(run.entries))
+	for i, entry := range run.entries {
+		records[i] = keyIndexRecord{Key: entry.key, Removed: entry.removed}
+	}
+
+	file, err := storage.CreateFile(absFilePath + ".swp")
+	if err != nil {
+		return err
+	}
+
+	err = writeKeyIndexRecords(storage, file, records)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return storage.Rename(absFilePath+".swp", absFilePath)
+}
+
+func sortKeyIndexEntries(entries []keyIndexEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+}
+
+// writeKeyIndexRecords writes records to file as JSON lines, and syncs it.
+func writeKeyIndexRecords(storage *bucketStorage, file File, records []keyIndexRecord) error {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+
+	for _, record := range records {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := file.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return storage.SyncFile(file)
+}
+
+func newKeyIndex(absDirPath string) *keyIndex {
+	return &keyIndex{
+		absDirPath:    absDirPath,
+		changes:       make(map[string]bool),
+		maxLogRecords: maxKeyIndexLogRecords,
+	}
+}
+
+// newKeyIndexRun returns a sorted run of the given entries rolled from the
+// logs numbered first to last, keeping only the last entry for each key.
+func newKeyIndexRun(first, last int, entries []keyIndexEntry) keyIndexRun {
+	latest := make(map[string]bool)
+	for _, entry := range entries {
+		latest[entry.key] = entry.removed
+	}
+
+	run := keyIndexRun{
+		first:   first,
+		last:    last,
+		entries: make([]keyIndexEntry, 0, len(latest)),
+	}
+
+	for key, removed := range latest {
+		run.entries = append(run.entries, keyIndexEntry{key: key, removed: removed})
+	}
+
+	sortKeyIndexEntries(run.entries)
+	return run
+}
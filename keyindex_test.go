@@ -0,0 +1,458 @@
+package keva
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+
+	collect := func(t *testing.T, keys func(func(string, error) bool)) []string {
+		var result []string
+
+		for key, err := range keys {
+			if err != nil {
+				t.Fatalf("Error when scanning keys: %v", err)
+			}
+			result = append(result, key)
+		}
+
+		return result
+	}
+
+	putKeys := func(t *testing.T, s *Store, keys ...string) {
+		for _, key := range keys {
+			err := s.Put(key, key)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+	}
+
+	t.Run("Range() and Scan() list keys in order", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithKeyIndex(), WithMaxObjectsPerBucket(2))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		putKeys(t, s, "pear", "apple", "banana", "apricot", "cherry", "ap")
+
+		for _, c := range []struct {
+			keys     func(func(string, error) bool)
+			expected []string
+		}{
+			{s.Range("", ""), []string{"ap", "apple", "apricot", "banana", "cherry", "pear"}},
+			{s.Range("apple", "cherry"), []string{"apple", "apricot", "banana"}},
+			{s.Range("b", ""), []string{"banana", "cherry", "pear"}},
+			{s.Range("q", ""), nil},
+			{s.Scan("ap"), []string{"ap", "apple", "apricot"}},
+			{s.Scan("apr"), []string{"apricot"}},
+			{s.Scan("z"), nil},
+		} {
+			if result := collect(t, c.keys); !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("Expected %v but got %v", c.expected, result)
+			}
+		}
+
+		var result []string
+
+		for key := range s.Range("", "") {
+			result = append(result, key)
+			if len(result) == 2 {
+				break
+			}
+		}
+		if expected := []string{"ap", "apple"}; !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected iteration to stop at %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("Range() reflects removed and replaced keys", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithKeyIndex())
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		putKeys(t, s, "a", "b", "c", "b")
+
+		err = s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		err = s.Remove("a")
+		if err != nil {
+			t.Fatalf("Error when removing value: %v", err)
+		}
+		putKeys(t, s, "c", "d")
+
+		if result, expected := collect(t, s.Range("", "")), []string{"b", "c", "d"}; !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("Range() excludes keys belonging to namespaces", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithKeyIndex())
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		fruit, err := s.Namespace("fruit")
+		if err != nil {
+			t.Fatalf("Error when obtaining namespace: %v", err)
+		}
+
+		putKeys(t, s, "abc123")
+
+		err = fruit.Put("abc456", "apple")
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+
+		if result, expected := collect(t, s.Range("", "")), []string{"abc123"}; !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("Range() returns ErrNoKeyIndex without WithKeyIndex()", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		for _, err := range s.Scan("abc") {
+			if !errors.Is(err, ErrNoKeyIndex) {
+				t.Errorf("Expected ErrNoKeyIndex but got %v", err)
+			}
+		}
+	})
+
+	t.Run("index is saved and reloaded with the store", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithKeyIndex())
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		putKeys(t, s, "b", "a", "c")
+
+		err = s.Remove("c")
+		if err != nil {
+			t.Fatalf("Error when removing value: %v", err)
+		}
+		s.Close()
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		if !s.manifest.KeyIndex || s.manifest.FormatVersion != keyIndexFormatVersion {
+			t.Errorf("Expected manifest to record the key index but got %+v", s.manifest)
+		}
+		if result, expected := collect(t, s.Range("", "")), []string{"a", "b"}; !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("flushes append changes to the log until they are rolled into a run", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithKeyIndex())
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		s.keyIndex.maxLogRecords = 10
+
+		indexPath := filepath.Join(rootPath, keyIndexDirName)
+
+		runNames := func() []string {
+			entries, err := ioutil.ReadDir(indexPath)
+			if err != nil {
+				t.Fatalf("Error reading key index: %v", err)
+			}
+
+			var names []string
+			for _, entry := range entries {
+				if _, _, ok := parseKeyIndexRunName(entry.Name()); ok {
+					names = append(names, entry.Name())
+				}
+			}
+			return names
+		}
+
+		initialRuns := runNames()
+
+		var expected []string
+
+		for i := 0; i < 30; i++ {
+			key := fmt.Sprintf("key%02d", i)
+			putKeys(t, s, key)
+			expected = append(expected, key)
+
+			err = s.Flush()
+			if err != nil {
+				t.Fatalf("Error when flushing store: %v", err)
+			}
+
+			if i == 5 {
+				if result := runNames(); !reflect.DeepEqual(result, initialRuns) {
+					t.Errorf("Expected runs %v to be left as they were but got %v", initialRuns, result)
+				}
+
+				content, err := ioutil.ReadFile(filepath.Join(indexPath, keyIndexLogName(s.keyIndex.logSeq)))
+				if err != nil {
+					t.Fatalf("Error reading key index log: %v", err)
+				}
+				if !bytes.Contains(content, []byte(`"key05"`)) {
+					t.Errorf("Expected log to hold the flushed key but got %s", content)
+				}
+			}
+		}
+
+		if result := runNames(); reflect.DeepEqual(result, initialRuns) {
+			t.Errorf("Expected changes to have been rolled into a new run")
+		}
+		if result := collect(t, s.Range("", "")); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+
+		s.Close()
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		if result := collect(t, s.Range("", "")); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("uncommitted changes are verified against buckets after a crash", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithKeyIndex(), WithMaxObjectsPerBucket(2), WithMaxBucketsCached(1))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		for i := 0; i < 20; i++ {
+			putKeys(t, s, fmt.Sprintf("key%02d", i))
+		}
+
+		err = s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		// With one bucket cached, these changes are logged and mostly saved
+		// as buckets are evicted, but never committed.
+
+		for i := 0; i < 10; i++ {
+			err = s.Remove(fmt.Sprintf("key%02d", i))
+			if err != nil {
+				t.Fatalf("Error when removing value: %v", err)
+			}
+		}
+		for i := 20; i < 30; i++ {
+			putKeys(t, s, fmt.Sprintf("key%02d", i))
+		}
+
+		// Copying the store while it is open leaves what a crash would.
+
+		crashedPath := newTempDir(t)
+		defer os.RemoveAll(crashedPath)
+
+		err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil || path == rootPath {
+				return err
+			}
+
+			relPath, _ := filepath.Rel(rootPath, path)
+			destPath := filepath.Join(crashedPath, relPath)
+
+			if info.IsDir() {
+				return os.Mkdir(destPath, 0700)
+			}
+
+			content, err := ioutil.ReadFile(path)
+			if err == nil {
+				err = ioutil.WriteFile(destPath, content, 0600)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error copying store: %v", err)
+		}
+
+		crashed, err := NewStore(crashedPath)
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+		defer crashed.Close()
+
+		var expected []string
+
+		for i := 0; i < 30; i++ {
+			key := fmt.Sprintf("key%02d", i)
+
+			present, err := crashed.hasKey(key)
+			if err != nil {
+				t.Fatalf("Error when retrieving value: %v", err)
+			}
+			if present {
+				expected = append(expected, key)
+			}
+		}
+
+		if result := collect(t, crashed.Range("", "")); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("index is rebuilt from buckets if it was not saved", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(2))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		var expected []string
+
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("key%02d", i)
+			putKeys(t, s, key)
+			expected = append(expected, key)
+		}
+		s.Close()
+
+		r, err := OpenReadOnly(rootPath, WithKeyIndex())
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+		if r.keyIndex != nil {
+			t.Errorf("Expected no key index for a store without one")
+		}
+		r.Close()
+
+		s, err = NewStore(rootPath, WithKeyIndex())
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		s.Close()
+
+		err = os.RemoveAll(filepath.Join(rootPath, keyIndexDirName))
+		if err != nil {
+			t.Fatalf("Expected key index to be saved but got %v", err)
+		}
+
+		r, err = OpenReadOnly(rootPath)
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+		if result := collect(t, r.Range("", "")); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+		r.Close()
+
+		_, err = os.Stat(filepath.Join(rootPath, keyIndexDirName))
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected read-only store not to save key index but got %v", err)
+		}
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		if result := collect(t, s.Range("", "")); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v but got %v", expected, result)
+		}
+	})
+
+	t.Run("stores without an index keep the initial format version", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		if s.manifest.FormatVersion != initialFormatVersion {
+			t.Errorf("Expected format version %d but got %d", initialFormatVersion, s.manifest.FormatVersion)
+		}
+	})
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for _, c := range []struct {
+		prefix   string
+		expected string
+	}{
+		{"", ""},
+		{"abc", "abd"},
+		{"ab\xff", "ac"},
+		{"\xff\xff", ""},
+	} {
+		if result := prefixEnd(c.prefix); result != c.expected {
+			t.Errorf("Expected prefix end of %q to be %q but got %q", c.prefix, c.expected, result)
+		}
+	}
+}
+
+func TestMergeKeyIndexRuns(t *testing.T) {
+	older := keyIndexRun{first: 1, last: 1, entries: []keyIndexEntry{{key: "a"}, {key: "b"}, {key: "c", removed: true}}}
+	newer := keyIndexRun{first: 2, last: 2, entries: []keyIndexEntry{{key: "b", removed: true}, {key: "d"}}}
+
+	merged := mergeKeyIndexRuns(older, newer)
+
+	if merged.first != 1 || merged.last != 2 {
+		t.Errorf("Expected merged run to cover logs 1 to 2 but got %d to %d", merged.first, merged.last)
+	}
+	if expected := []keyIndexEntry{{key: "a"}, {key: "b", removed: true}, {key: "c", removed: true}, {key: "d"}}; !reflect.DeepEqual(merged.entries, expected) {
+		t.Errorf("Expected %v but got %v", expected, merged.entries)
+	}
+
+	older.first = 0
+	merged = mergeKeyIndexRuns(older, newer)
+
+	if expected := []keyIndexEntry{{key: "a"}, {key: "d"}}; !reflect.DeepEqual(merged.entries, expected) {
+		t.Errorf("Expected removals to be dropped from the oldest run but got %v", merged.entries)
+	}
+}
@@ -0,0 +1,14 @@
+package keva
+
+// KeyValue is the interface implemented by Store and MemoryStore, for code
+// which stores values by key without depending on how they are kept.
+type KeyValue interface {
+	Get(key string, dest interface{}) error
+	Put(key string, value interface{}) error
+	Remove(key string) error
+	Flush() error
+	Close() error
+}
+
+var _ KeyValue = (*Store)(nil)
+var _ KeyValue = (*MemoryStore)(nil)
@@ -0,0 +1,137 @@
+package keva
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+
+	t.Run("Operations after Close() return ErrClosed", func(t *testing.T) {
+		s := newTempStore(t)
+		defer os.RemoveAll(s.rootPath)
+
+		err := s.Close()
+		if err != nil {
+			t.Fatalf("Error closing store: %v", err)
+		}
+
+		var value string
+
+		if err := s.Get("a", &value); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Get() but got %v", err)
+		}
+		if err := s.Put("a", "b"); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Put() but got %v", err)
+		}
+		if err := s.Remove("a"); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Remove() but got %v", err)
+		}
+		if err := s.Flush(); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Flush() but got %v", err)
+		}
+		if err := s.Close(); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Close() but got %v", err)
+		}
+		if err := s.Destroy(); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Destroy() but got %v", err)
+		}
+	})
+
+	t.Run("Put() after Destroy() returns ErrClosed without recreating files", func(t *testing.T) {
+		s := newTempStore(t)
+
+		err := s.Destroy()
+		if err != nil {
+			t.Fatalf("Error destroying store: %v", err)
+		}
+
+		if err := s.Put("a", "b"); err != ErrClosed {
+			t.Errorf("Expected ErrClosed from Put() but got %v", err)
+		}
+
+		_, err = os.Stat(s.rootPath)
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected store location not to exist but got %v", err)
+		}
+	})
+
+	t.Run("Info() after Close() leaves a shared cache untouched", func(t *testing.T) {
+		cache, err := NewCache(16)
+		if err != nil {
+			t.Fatalf("Could not create cache: %v", err)
+		}
+
+		s := newTempStore(t, WithCache(cache))
+		defer os.RemoveAll(s.rootPath)
+
+		s.Put("a", "b")
+		s.Close()
+
+		if info := s.Info(); info != (StoreInfo{}) {
+			t.Errorf("Expected zero statistics but got %+v", info)
+		}
+		if _, ok := cache.buckets.owners[s.storage]; ok {
+			t.Errorf("Expected closed store to have no cache entries")
+		}
+	})
+
+	t.Run("Close() waits for operations in progress", func(t *testing.T) {
+		s := newTempStore(t)
+		defer os.RemoveAll(s.rootPath)
+
+		var wg sync.WaitGroup
+		var succeeded sync.Map
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				for j := 0; j < 100; j++ {
+					key := fmt.Sprintf("key%d-%d", i, j)
+
+					err := s.Put(key, j)
+					if err == ErrClosed {
+						return
+					}
+					if err != nil {
+						t.Errorf("Error storing value: %v", err)
+						return
+					}
+
+					succeeded.Store(key, j)
+				}
+			}(i)
+		}
+
+		err := s.Close()
+		if err != nil {
+			t.Fatalf("Error closing store: %v", err)
+		}
+
+		wg.Wait()
+
+		s, err = NewStore(s.rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		succeeded.Range(func(key, expected interface{}) bool {
+			var value int
+
+			err := s.Get(key.(string), &value)
+			if err != nil {
+				t.Errorf("Expected value for '%s' to have been persisted but got %v", key, err)
+			} else if value != expected.(int) {
+				t.Errorf("Expected %d for '%s' but got %d", expected, key, value)
+			}
+
+			return true
+		})
+	})
+}
@@ -0,0 +1,247 @@
+package keva
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+const manifestFileName = "keva.json"
+
+// CurrentFormatVersion is the latest version of the on-disk store format
+// written by this package. Stores are written in the earliest version which
+// supports the features they use, so that older versions of the package can
+// still open them.
+const CurrentFormatVersion = keyIndexFormatVersion
+
+// initialFormatVersion is the format version of stores using no features
+// introduced since.
+const initialFormatVersion = 1
+
+// keyIndexFormatVersion is the format version of stores with a key index,
+// which older versions of the package would leave out of date.
+const keyIndexFormatVersion = 2
+
+// ErrIncompatibleStore indicates that a store was written in a format, or
+// with a layout, which this package cannot read.
+var ErrIncompatibleStore = errors.New("incompatible store")
+
+type storeManifest struct {
+	FormatVersion           int          `json:"formatVersion"`
+	BucketPathSegmentLength int          `json:"bucketPathSegmentLength"`
+	HashFunction            HashFunction `json:"hashFunction"`
+	MaxObjectsPerBucket     int          `json:"maxObjectsPerBucket"`
+	MaxBytesPerBucket       int64        `json:"maxBytesPerBucket,omitempty"`
+	Codec                   string       `json:"codec,omitempty"`
+	Namespaces              []string     `json:"namespaces,omitempty"`
+	KeyIndex                bool         `json:"keyIndex,omitempty"`
+}
+
+func (m *storeManifest) Load(storage *bucketStorage) error {
+	content, err := storage.ReadFile(filepath.Join(storage.rootPath, manifestFileName))
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(content, m)
+	if err != nil {
+		return fmt.Errorf("%w: unreadable manifest: %v", ErrIncompatibleStore, err)
+	}
+
+	return m.Validate()
+}
+
+// Reconcile checks that the manifest is compatible with the given options,
+// and records any persistent settings which they change.
+func (m *storeManifest) Reconcile(o options, storage *bucketStorage) error {
+	err := m.CheckOptions(o)
+	if err != nil {
+		return err
+	}
+
+	err = m.checkLayout(o)
+	if err != nil {
+		return err
+	}
+
+	updated := *m
+	updated.setSplitPolicy(o.reconcileSplitPolicy(m.splitPolicy()))
+
+	if o.keyIndex {
+		updated.enableKeyIndex()
+	}
+
+	if updated.MaxObjectsPerBucket == m.MaxObjectsPerBucket && updated.MaxBytesPerBucket == m.MaxBytesPerBucket && updated.KeyIndex == m.KeyIndex {
+		return nil
+	}
+
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = updated.Save(storage)
+	if err != nil {
+		return err
+	}
+
+	*m = updated
+	return nil
+}
+
+// CheckOptions checks that the manifest is compatible with the given options.
+func (m *storeManifest) CheckOptions(o options) error {
+	if codecName := m.codecName(); codecName != o.codec.Name() {
+		return fmt.Errorf("%w: store uses codec '%s' but '%s' was specified", ErrIncompatibleStore, codecName, o.codec.Name())
+	}
+
+	return nil
+}
+
+func (m *storeManifest) Save(storage *bucketStorage) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	absFilePath := filepath.Join(storage.rootPath, manifestFileName)
+
+	file, err := storage.CreateFile(absFilePath + ".swp")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = storage.SyncFile(file)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return storage.Rename(absFilePath+".swp", absFilePath)
+}
+
+func (m *storeManifest) Validate() error {
+	if m.FormatVersion < 1 || m.FormatVersion > CurrentFormatVersion {
+		return fmt.Errorf("%w: format version %d is not supported (expected at most %d)", ErrIncompatibleStore, m.FormatVersion, CurrentFormatVersion)
+	}
+	if m.BucketPathSegmentLength < 1 || m.BucketPathSegmentLength > MaxBucketPathSegmentLength {
+		return fmt.Errorf("%w: bucket path segment length %d is not supported", ErrIncompatibleStore, m.BucketPathSegmentLength)
+	}
+	if !m.HashFunction.isSupported() {
+		return fmt.Errorf("%w: hash function '%s' is not supported", ErrIncompatibleStore, m.HashFunction)
+	}
+	if err := m.splitPolicy().Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrIncompatibleStore, err)
+	}
+
+	return nil
+}
+
+// checkLayout checks that the manifest's bucket layout matches any given by
+// the options.
+func (m *storeManifest) checkLayout(o options) error {
+	if n := o.bucketPathSegmentLength; n != 0 && n != m.BucketPathSegmentLength {
+		return fmt.Errorf("%w: store uses bucket path segment length %d but %d was specified", ErrIncompatibleStore, m.BucketPathSegmentLength, n)
+	}
+	if h := o.hashFunction; h != "" && h != m.HashFunction {
+		return fmt.Errorf("%w: store uses hash function '%s' but '%s' was specified", ErrIncompatibleStore, m.HashFunction, h)
+	}
+
+	return nil
+}
+
+func (m *storeManifest) codecName() string {
+	if m.Codec == "" {
+		return JSONCodec.Name()
+	}
+
+	return m.Codec
+}
+
+func (m *storeManifest) enableKeyIndex() {
+	m.KeyIndex = true
+
+	if m.FormatVersion < keyIndexFormatVersion {
+		m.FormatVersion = keyIndexFormatVersion
+	}
+}
+
+func (m *storeManifest) setSplitPolicy(p SplitPolicy) {
+	m.MaxObjectsPerBucket = p.MaxObjects
+	m.MaxBytesPerBucket = p.MaxBytes
+}
+
+func (m *storeManifest) splitPolicy() SplitPolicy {
+	return SplitPolicy{
+		MaxObjects: m.MaxObjectsPerBucket,
+		MaxBytes:   m.MaxBytesPerBucket,
+	}
+}
+
+func newStoreManifest(o options) storeManifest {
+	m := storeManifest{
+		FormatVersion:           initialFormatVersion,
+		BucketPathSegmentLength: DefaultBucketPathSegmentLength,
+		HashFunction:            SHA256,
+		Codec:                   o.codec.Name(),
+	}
+
+	if o.bucketPathSegmentLength != 0 {
+		m.BucketPathSegmentLength = o.bucketPathSegmentLength
+	}
+	if o.hashFunction != "" {
+		m.HashFunction = o.hashFunction
+	}
+
+	m.setSplitPolicy(o.reconcileSplitPolicy(SplitPolicy{MaxObjects: DefaultMaxObjectsPerBucket}))
+
+	if o.keyIndex {
+		m.enableKeyIndex()
+	}
+
+	return m
+}
+
+// initStoreManifest returns the manifest for a store at storage's root which
+// has none. A store which already holds buckets was written before manifests
+// were introduced, when every store used the default layout and codec, so
+// options conflicting with those are rejected rather than recorded.
+func initStoreManifest(o options, storage *bucketStorage) (storeManifest, error) {
+	entries, err := storage.ReadDir(storage.rootPath)
+	if err != nil {
+		return storeManifest{}, err
+	}
+
+	m := newStoreManifest(o)
+
+	for _, entry := range entries {
+		if bucketName, _ := splitLayoutName(entry.Name()); bucketName == "" {
+			continue
+		}
+
+		m.BucketPathSegmentLength = DefaultBucketPathSegmentLength
+		m.HashFunction = SHA256
+		m.Codec = ""
+
+		err = m.CheckOptions(o)
+		if err == nil {
+			err = m.checkLayout(o)
+		}
+		if err != nil {
+			return storeManifest{}, err
+		}
+
+		break
+	}
+
+	return m, m.Validate()
+}
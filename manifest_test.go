@@ -0,0 +1,122 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+
+	t.Run("NewStore() persists max objects per bucket", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		err = s.SetMaxObjectsPerBucket(17)
+		if err != nil {
+			t.Fatalf("Error setting max objects per bucket: %v", err)
+		}
+		s.Close()
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+
+		if s.splitPolicy.MaxObjects != 17 {
+			t.Errorf("Expected max objects per bucket to be 17 but got %d", s.splitPolicy.MaxObjects)
+		}
+	})
+
+	t.Run("NewStore() rejects an incompatible format version", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		manifest := newStoreManifest(newOptions(nil))
+		manifest.FormatVersion = CurrentFormatVersion + 1
+
+		err := manifest.Save(newTestStorage(rootPath))
+		if err != nil {
+			t.Fatalf("Error saving manifest: %v", err)
+		}
+
+		_, err = NewStore(rootPath)
+		if !errors.Is(err, ErrIncompatibleStore) {
+			t.Errorf("Expected ErrIncompatibleStore but got %v", err)
+		}
+	})
+
+	t.Run("SetMaxObjectsPerBucket() rejects invalid values", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		err = s.SetMaxObjectsPerBucket(0)
+		if err == nil {
+			t.Errorf("Expected an error but got nothing")
+		}
+		if s.splitPolicy.MaxObjects != DefaultMaxObjectsPerBucket {
+			t.Errorf("Expected max objects per bucket to be unchanged but got %d", s.splitPolicy.MaxObjects)
+		}
+	})
+
+	t.Run("NewStore() records the default layout for stores written before manifests", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		for i := 0; i < 50; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+		s.Close()
+
+		err = os.Remove(filepath.Join(rootPath, manifestFileName))
+		if err != nil {
+			t.Fatalf("Error removing manifest: %v", err)
+		}
+
+		for _, opt := range []Option{WithBucketPathSegmentLength(3), WithHashFunction(FNV1a128)} {
+			_, err = NewStore(rootPath, opt)
+			if !errors.Is(err, ErrIncompatibleStore) {
+				t.Errorf("Expected ErrIncompatibleStore but got %v", err)
+			}
+		}
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		if s.manifest.BucketPathSegmentLength != DefaultBucketPathSegmentLength || s.manifest.HashFunction != SHA256 {
+			t.Errorf("Expected default layout but got %+v", s.manifest)
+		}
+
+		for i := 0; i < 50; i++ {
+			var value int
+
+			err = s.Get(fmt.Sprintf("key%d", i), &value)
+			if err != nil {
+				t.Errorf("Error when retrieving value: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package keva
+
+import "sync"
+
+// MemoryStore is a KeyValue which keeps values in memory, for use where a
+// Store's persistence isn't needed, such as in tests. Values are encoded as
+// JSON when they are put, so they round-trip exactly as they would through a
+// Store using JSONCodec.
+type MemoryStore struct {
+	lock    sync.RWMutex
+	objects map[string][]byte
+	closed  bool
+}
+
+// Close releases the store's contents. Every operation on the store
+// afterwards, including Close itself, returns ErrClosed.
+func (m *MemoryStore) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.objects = nil
+	m.closed = true
+	return nil
+}
+
+// Flush does nothing, as a MemoryStore has nothing to persist.
+func (m *MemoryStore) Flush() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) Get(key string, dest interface{}) error {
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	encodedValue, ok := m.objects[key]
+	if !ok {
+		return ErrValueNotFound
+	}
+
+	return JSONCodec.Unmarshal(encodedValue, dest)
+}
+
+func (m *MemoryStore) Put(key string, value interface{}) error {
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	encodedValue, err := JSONCodec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.objects[key] = encodedValue
+	return nil
+}
+
+func (m *MemoryStore) Remove(key string) error {
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	delete(m.objects, key)
+	return nil
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string][]byte),
+	}
+}
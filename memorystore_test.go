@@ -0,0 +1,101 @@
+package keva
+
+import "testing"
+
+func TestMemoryStore(t *testing.T) {
+
+	for _, c := range []struct {
+		name     string
+		newStore func(t *testing.T) (KeyValue, func())
+	}{
+		{"Store", func(t *testing.T) (KeyValue, func()) {
+			s := newTempStore(t)
+			return s, func() { s.Destroy() }
+		}},
+		{"MemoryStore", func(t *testing.T) (KeyValue, func()) {
+			return NewMemoryStore(), func() {}
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+
+			t.Run("Put() and Get() can be roundtripped", func(t *testing.T) {
+				kv, cleanUp := c.newStore(t)
+				defer cleanUp()
+
+				value := testValue{Name: "apple", Colour: "red"}
+
+				err := kv.Put("abc123", value)
+				if err != nil {
+					t.Fatalf("Error when storing value: %v", err)
+				}
+
+				value.Colour = "green"
+
+				var result testValue
+
+				err = kv.Get("abc123", &result)
+				if err != nil {
+					t.Fatalf("Error when retrieving value: %v", err)
+				}
+				if result.Name != "apple" || result.Colour != "red" {
+					t.Errorf("Expected stored value but got %+v", result)
+				}
+			})
+
+			t.Run("Get() returns ErrValueNotFound for missing and removed keys", func(t *testing.T) {
+				kv, cleanUp := c.newStore(t)
+				defer cleanUp()
+
+				var result string
+
+				err := kv.Get("abc123", &result)
+				if err != ErrValueNotFound {
+					t.Errorf("Expected ErrValueNotFound but got %v", err)
+				}
+
+				kv.Put("abc123", "apple")
+				kv.Remove("abc123")
+
+				err = kv.Get("abc123", &result)
+				if err != ErrValueNotFound {
+					t.Errorf("Expected ErrValueNotFound but got %v", err)
+				}
+			})
+
+			t.Run("Put() rejects reserved keys", func(t *testing.T) {
+				kv, cleanUp := c.newStore(t)
+				defer cleanUp()
+
+				err := kv.Put("\x00abc", "apple")
+				if err != ErrReservedKey {
+					t.Errorf("Expected ErrReservedKey but got %v", err)
+				}
+			})
+
+			t.Run("Close() causes subsequent operations to return ErrClosed", func(t *testing.T) {
+				kv, cleanUp := c.newStore(t)
+				defer cleanUp()
+
+				err := kv.Close()
+				if err != nil {
+					t.Fatalf("Error when closing store: %v", err)
+				}
+
+				var result string
+
+				if err := kv.Get("abc123", &result); err != ErrClosed {
+					t.Errorf("Expected ErrClosed from Get() but got %v", err)
+				}
+				if err := kv.Put("abc123", "apple"); err != ErrClosed {
+					t.Errorf("Expected ErrClosed from Put() but got %v", err)
+				}
+				if err := kv.Flush(); err != ErrClosed {
+					t.Errorf("Expected ErrClosed from Flush() but got %v", err)
+				}
+				if err := kv.Close(); err != ErrClosed {
+					t.Errorf("Expected ErrClosed from Close() but got %v", err)
+				}
+			})
+		})
+	}
+}
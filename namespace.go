@@ -0,0 +1,255 @@
+package keva
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const namespaceKeyPrefix = "\x00"
+
+// ErrReservedKey indicates that a key beginning with a NUL character was used
+// directly with a Store. Such keys are reserved for namespaces.
+//
+// This is a breaking change for stores written by versions of this package
+// which predate namespaces: values stored under such keys can no longer be
+// read, replaced or removed with Get, Put and Remove. They are still written
+// by Export, so they can be recovered by exporting the store and importing
+// the values under new keys into a fresh one.
+var ErrReservedKey = errors.New("keys beginning with NUL are reserved")
+
+// Namespace is a handle to a set of keys within a store which is isolated
+// from the store's other keys and other namespaces. Namespaces share their
+// store's cache, locks and flushes.
+type Namespace struct {
+	name          string
+	store         *Store
+	keyPrefix     string
+	getCount      uint64
+	putCount      uint64
+	removeCount   uint64
+	notFoundCount uint64
+}
+
+// NamespaceInfo holds statistics about operations on a namespace since its
+// store was opened.
+type NamespaceInfo struct {
+	GetCount      uint64
+	PutCount      uint64
+	RemoveCount   uint64
+	NotFoundCount uint64
+}
+
+// Drop removes every key in the namespace and removes the namespace from the
+// store's list of namespaces. The namespace can still be used afterwards, but
+// won't be listed again until it is next obtained with Store.Namespace.
+func (ns *Namespace) Drop() error {
+	s := ns.store
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	var keys []string
+
+	err := s.forEachObject(func(key string, encodedValue []byte) error {
+		if strings.HasPrefix(key, ns.keyPrefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err = s.removeKey(context.Background(), key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.unregisterNamespace(ns.name)
+}
+
+// Flush flushes the namespace's store.
+func (ns *Namespace) Flush() error {
+	return ns.store.Flush()
+}
+
+// Get retrieves the value for the given key in the namespace. See Store.Get.
+func (ns *Namespace) Get(key string, dest interface{}) error {
+	return ns.GetContext(context.Background(), key, dest)
+}
+
+// GetContext is like Get, but gives up with the context's error if ctx is done
+// while waiting for the key's bucket to become available.
+func (ns *Namespace) GetContext(ctx context.Context, key string, dest interface{}) error {
+	atomic.AddUint64(&ns.getCount, 1)
+
+	err := ns.store.getKey(ctx, ns.keyPrefix+key, dest)
+	if err == ErrValueNotFound {
+		atomic.AddUint64(&ns.notFoundCount, 1)
+	}
+
+	return err
+}
+
+// Info returns statistics about operations on the namespace.
+func (ns *Namespace) Info() NamespaceInfo {
+	return NamespaceInfo{
+		GetCount:      atomic.LoadUint64(&ns.getCount),
+		PutCount:      atomic.LoadUint64(&ns.putCount),
+		RemoveCount:   atomic.LoadUint64(&ns.removeCount),
+		NotFoundCount: atomic.LoadUint64(&ns.notFoundCount),
+	}
+}
+
+// Name returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Put stores a value under the given key in the namespace. See Store.Put.
+func (ns *Namespace) Put(key string, value interface{}) error {
+	return ns.PutContext(context.Background(), key, value)
+}
+
+// PutContext is like Put, but gives up with the context's error if ctx is done
+// while waiting for the key's bucket to become available.
+func (ns *Namespace) PutContext(ctx context.Context, key string, value interface{}) error {
+	atomic.AddUint64(&ns.putCount, 1)
+
+	encodedValue, err := ns.store.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return ns.store.putEncoded(ctx, ns.keyPrefix+key, encodedValue)
+}
+
+// Remove removes the value for the given key in the namespace.
+func (ns *Namespace) Remove(key string) error {
+	return ns.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is like Remove, but gives up with the context's error if ctx
+// is done while waiting for the key's bucket to become available.
+func (ns *Namespace) RemoveContext(ctx context.Context, key string) error {
+	atomic.AddUint64(&ns.removeCount, 1)
+
+	return ns.store.removeKey(ctx, ns.keyPrefix+key)
+}
+
+// Namespace returns a handle to the namespace with the given name, which must
+// not be empty or contain NUL characters. The namespace is recorded in the
+// store's manifest so that it is listed by Namespaces.
+//
+// Keys in a namespace are stored in the same buckets as the store's other
+// keys, prefixed so that they can't collide with them.
+func (s *Store) Namespace(name string) (*Namespace, error) {
+	if name == "" || strings.Contains(name, "\x00") {
+		return nil, fmt.Errorf("invalid namespace name '%s'", name)
+	}
+
+	err := s.beginOperation()
+	if err != nil {
+		return nil, err
+	}
+	defer s.endOperation()
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	if !s.readOnly {
+		err = s.registerNamespaceLocked(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ns, ok := s.namespaces[name]
+	if !ok {
+		ns = &Namespace{
+			name:      name,
+			store:     s,
+			keyPrefix: namespaceKeyPrefix + name + namespaceKeyPrefix,
+		}
+		s.namespaces[name] = ns
+	}
+
+	return ns, nil
+}
+
+// Namespaces returns the names of all the namespaces in the store, in sorted
+// order.
+func (s *Store) Namespaces() []string {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	names := append([]string(nil), s.manifest.Namespaces...)
+	sort.Strings(names)
+	return names
+}
+
+func (s *Store) registerNamespaceLocked(name string) error {
+	for _, existing := range s.manifest.Namespaces {
+		if existing == name {
+			return nil
+		}
+	}
+
+	manifest := s.manifest
+	manifest.Namespaces = append(append([]string(nil), manifest.Namespaces...), name)
+
+	err := manifest.Save(s.storage)
+	if err != nil {
+		return err
+	}
+
+	s.manifest = manifest
+	return nil
+}
+
+func (s *Store) unregisterNamespace(name string) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	manifest := s.manifest
+	manifest.Namespaces = nil
+
+	for _, existing := range s.manifest.Namespaces {
+		if existing != name {
+			manifest.Namespaces = append(manifest.Namespaces, existing)
+		}
+	}
+
+	err = manifest.Save(s.storage)
+	if err != nil {
+		return err
+	}
+
+	s.manifest = manifest
+	return nil
+}
+
+// copyNamespaces registers every namespace of src in dest.
+func copyNamespaces(dest, src *Store) error {
+	for _, name := range src.Namespaces() {
+		_, err := dest.Namespace(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
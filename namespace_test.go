@@ -0,0 +1,170 @@
+package keva
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+
+	t.Run("Put() and Get() are isolated from the store and other namespaces", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		fruit, err := s.Namespace("fruit")
+		if err != nil {
+			t.Fatalf("Error when obtaining namespace: %v", err)
+		}
+		veg, err := s.Namespace("veg")
+		if err != nil {
+			t.Fatalf("Error when obtaining namespace: %v", err)
+		}
+
+		s.Put("abc123", "root")
+		fruit.Put("abc123", "apple")
+		veg.Put("abc123", "carrot")
+
+		for _, c := range []struct {
+			get      func(string, interface{}) error
+			expected string
+		}{
+			{s.Get, "root"},
+			{fruit.Get, "apple"},
+			{veg.Get, "carrot"},
+		} {
+			var result string
+
+			err := c.get("abc123", &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value: %v", err)
+			}
+			if result != c.expected {
+				t.Errorf("Expected '%s' but got '%s'", c.expected, result)
+			}
+		}
+
+		fruit.Remove("abc123")
+
+		var result string
+
+		err = fruit.Get("abc123", &result)
+		if err != ErrValueNotFound {
+			t.Errorf("Expected value to be removed but got %v", err)
+		}
+		err = veg.Get("abc123", &result)
+		if err != nil || result != "carrot" {
+			t.Errorf("Expected other namespace to be unaffected but got '%s' (%v)", result, err)
+		}
+	})
+
+	t.Run("Namespaces() lists namespaces across reopens", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		s.Namespace("veg")
+		s.Namespace("fruit")
+		s.Namespace("veg")
+
+		err := s.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		s, err = NewStore(s.rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+
+		names := s.Namespaces()
+		if len(names) != 2 || names[0] != "fruit" || names[1] != "veg" {
+			t.Errorf("Expected namespaces [fruit veg] but got %v", names)
+		}
+	})
+
+	t.Run("Namespace() rejects invalid names", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		for _, name := range []string{"", "a\x00b"} {
+			_, err := s.Namespace(name)
+			if err == nil {
+				t.Errorf("Expected an error for namespace name %q", name)
+			}
+		}
+	})
+
+	t.Run("Info() returns operation counts", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		ns, _ := s.Namespace("fruit")
+
+		var result string
+
+		ns.Put("abc123", "apple")
+		ns.Get("abc123", &result)
+		ns.Get("def456", &result)
+		ns.Remove("abc123")
+
+		info := ns.Info()
+		expected := NamespaceInfo{GetCount: 2, PutCount: 1, RemoveCount: 1, NotFoundCount: 1}
+
+		if info != expected {
+			t.Errorf("Expected %+v but got %+v", expected, info)
+		}
+	})
+
+	t.Run("Drop() removes all keys and unlists the namespace", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+		s.SetMaxObjectsPerBucket(4)
+
+		fruit, _ := s.Namespace("fruit")
+		veg, _ := s.Namespace("veg")
+
+		for i := 0; i < 50; i++ {
+			fruit.Put(string(rune('a'+i%26))+string(rune('a'+i/26)), i)
+		}
+		veg.Put("carrot", 1)
+
+		err := fruit.Drop()
+		if err != nil {
+			t.Fatalf("Error when dropping namespace: %v", err)
+		}
+
+		var result int
+
+		for i := 0; i < 50; i++ {
+			err := fruit.Get(string(rune('a'+i%26))+string(rune('a'+i/26)), &result)
+			if err != ErrValueNotFound {
+				t.Fatalf("Expected key %d to be removed but got %v", i, err)
+			}
+		}
+
+		err = veg.Get("carrot", &result)
+		if err != nil {
+			t.Errorf("Expected other namespace to be unaffected but got %v", err)
+		}
+
+		if names := s.Namespaces(); len(names) != 1 || names[0] != "veg" {
+			t.Errorf("Expected namespaces [veg] but got %v", names)
+		}
+	})
+
+	t.Run("Store rejects reserved keys", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		var result string
+
+		if err := s.Put("\x00abc", "value"); !errors.Is(err, ErrReservedKey) {
+			t.Errorf("Expected ErrReservedKey from Put() but got %v", err)
+		}
+		if err := s.Get("\x00abc", &result); !errors.Is(err, ErrReservedKey) {
+			t.Errorf("Expected ErrReservedKey from Get() but got %v", err)
+		}
+		if err := s.Remove("\x00abc"); !errors.Is(err, ErrReservedKey) {
+			t.Errorf("Expected ErrReservedKey from Remove() but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefaultDirPermissions are the permissions given to directories created by a
+// store unless WithDirPermissions is specified.
+const DefaultDirPermissions os.FileMode = 0700
+
+// DefaultFilePermissions are the permissions given to files created by a store
+// unless WithFilePermissions is specified.
+const DefaultFilePermissions os.FileMode = 0600
+
+// ErrInvalidOption indicates that a store was opened with an option value
+// which cannot be used, such as a non-positive number of lock partitions.
+var ErrInvalidOption = errors.New("invalid option")
+
+// SyncMode determines how a store uses fsync when saving buckets.
+type SyncMode int
+
+const (
+	// SyncFiles syncs each bucket file before renaming it into place. This
+	// is the default.
+	SyncFiles SyncMode = iota
+
+	// SyncNone never syncs, leaving durability to the operating system. This
+	// is faster, but bucket files may be lost or truncated on power loss.
+	SyncNone
+
+	// SyncDirectories syncs files like SyncFiles, and also syncs directories
+	// after files or directories are created, renamed or removed in them.
+	// Filesystems such as ext4 and XFS may otherwise lose such changes on
+	// power loss, even once the files involved have been synced.
+	SyncDirectories
+)
+
+// Option configures a store when it is opened.
+type Option func(*options)
+
+type options struct {
+	bucketPathSegmentLength int
+	hashFunction            HashFunction
+	cache                   *Cache
+	maxBucketsCached        int
+	maxObjectsPerBucket     int
+	splitPolicy             *SplitPolicy
+	lockPartitions          int
+	dirPermissions          os.FileMode
+	filePermissions         os.FileMode
+	syncMode                SyncMode
+	codec                   Codec
+	fileSystem              FileSystem
+	liveUpdates             bool
+	keyIndex                bool
+}
+
+// WithBucketPathSegmentLength sets the number of characters of bucket IDs
+// used to name each directory level of a new store, between 1 and
+// MaxBucketPathSegmentLength. Longer segments give each directory more
+// buckets, and very large stores fewer directory levels. The setting is
+// recorded in the store's manifest, and must match it if the store already
+// exists; use Reshard to change it.
+func WithBucketPathSegmentLength(n int) Option {
+	return func(o *options) {
+		o.bucketPathSegmentLength = n
+	}
+}
+
+// WithCache makes the store use the given cache, which may be shared with
+// other stores, instead of one of its own. WithMaxBucketsCached has no effect
+// when this is specified.
+func WithCache(c *Cache) Option {
+	return func(o *options) {
+		o.cache = c
+	}
+}
+
+// WithCodec sets the codec used to encode values. It must match the codec
+// the store was created with.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithDirPermissions sets the permissions of directories created by the store.
+func WithDirPermissions(perm os.FileMode) Option {
+	return func(o *options) {
+		o.dirPermissions = perm
+	}
+}
+
+// WithFilePermissions sets the permissions of files created by the store.
+func WithFilePermissions(perm os.FileMode) Option {
+	return func(o *options) {
+		o.filePermissions = perm
+	}
+}
+
+// WithFileSystem sets the filesystem on which the store is kept.
+func WithFileSystem(fs FileSystem) Option {
+	return func(o *options) {
+		o.fileSystem = fs
+	}
+}
+
+// WithHashFunction sets the hash function used to place keys in the buckets
+// of a new store. The setting is recorded in the store's manifest, and must
+// match it if the store already exists; use Reshard to change it.
+func WithHashFunction(h HashFunction) Option {
+	return func(o *options) {
+		o.hashFunction = h
+	}
+}
+
+// WithKeyIndex maintains an ordered index of the store's keys alongside its
+// buckets, so that keys can be listed with Scan and Range. The index is saved
+// when the store is flushed or closed, and rebuilt from the buckets when the
+// store is opened if it was not saved, as after a crash.
+//
+// The setting is recorded in the store's manifest, so the index is maintained
+// whenever the store is opened afterwards. Stores with a key index cannot be
+// opened by versions of this package which predate it.
+func WithKeyIndex() Option {
+	return func(o *options) {
+		o.keyIndex = true
+	}
+}
+
+// WithLiveUpdates allows a store opened with OpenReadOnly to be used while
+// another process writes to it. No shared lock is taken, and cached buckets
+// are checked against their files on every access so that buckets replaced or
+// split by the writer are reloaded rather than served stale.
+//
+// Changes are only visible to readers once the writer has saved them, either
+// by flushing or by evicting buckets from its cache. The option has no effect
+// on stores opened with NewStore.
+func WithLiveUpdates() Option {
+	return func(o *options) {
+		o.liveUpdates = true
+	}
+}
+
+// WithLockPartitions sets the number of partitions used to lock buckets.
+// More partitions allow more operations on different buckets to proceed
+// concurrently.
+func WithLockPartitions(n int) Option {
+	return func(o *options) {
+		o.lockPartitions = n
+	}
+}
+
+// WithMaxBucketsCached sets the number of buckets held in the write-back
+// cache.
+func WithMaxBucketsCached(n int) Option {
+	return func(o *options) {
+		o.maxBucketsCached = n
+	}
+}
+
+// WithMaxObjectsPerBucket sets the number of objects a bucket may hold before
+// it is split. The setting is recorded in the store's manifest; if it is not
+// specified, the store's previous setting is used.
+func WithMaxObjectsPerBucket(n int) Option {
+	return func(o *options) {
+		o.maxObjectsPerBucket = n
+	}
+}
+
+// WithSplitPolicy sets when buckets are split. The policy is recorded in the
+// store's manifest; if it is not specified, the store's previous policy is
+// used. WithMaxObjectsPerBucket, if also specified, overrides the policy's
+// object limit.
+func WithSplitPolicy(p SplitPolicy) Option {
+	return func(o *options) {
+		o.splitPolicy = &p
+	}
+}
+
+// WithSyncMode sets how the store uses fsync when saving buckets.
+func WithSyncMode(mode SyncMode) Option {
+	return func(o *options) {
+		o.syncMode = mode
+	}
+}
+
+// Validate returns an error wrapping ErrInvalidOption if any option value
+// cannot be used.
+func (o options) Validate() error {
+	if n := o.bucketPathSegmentLength; n < 0 || n > MaxBucketPathSegmentLength {
+		return fmt.Errorf("%w: bucket path segment length must be between 1 and %d but %d was specified", ErrInvalidOption, MaxBucketPathSegmentLength, n)
+	}
+	if h := o.hashFunction; h != "" && !h.isSupported() {
+		return fmt.Errorf("%w: hash function '%s' is not supported", ErrInvalidOption, h)
+	}
+	if o.cache == nil {
+		err := validateMaxBucketsCached(o.maxBucketsCached)
+		if err != nil {
+			return err
+		}
+	}
+	if o.lockPartitions < 1 {
+		return fmt.Errorf("%w: lock partitions must be positive but %d was specified", ErrInvalidOption, o.lockPartitions)
+	}
+	if o.maxObjectsPerBucket < 0 {
+		return fmt.Errorf("%w: max objects per bucket must not be negative but %d was specified", ErrInvalidOption, o.maxObjectsPerBucket)
+	}
+	if o.splitPolicy != nil {
+		err := o.splitPolicy.Validate()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidOption, err)
+		}
+	}
+	if o.syncMode < SyncFiles || o.syncMode > SyncDirectories {
+		return fmt.Errorf("%w: sync mode %d is not supported", ErrInvalidOption, o.syncMode)
+	}
+	if o.codec == nil {
+		return fmt.Errorf("%w: codec must not be nil", ErrInvalidOption)
+	}
+	if o.fileSystem == nil {
+		return fmt.Errorf("%w: filesystem must not be nil", ErrInvalidOption)
+	}
+
+	return nil
+}
+
+// reconcileSplitPolicy returns the split policy to use in place of current,
+// as specified by WithSplitPolicy and WithMaxObjectsPerBucket.
+func (o options) reconcileSplitPolicy(current SplitPolicy) SplitPolicy {
+	p := current
+
+	if o.splitPolicy != nil {
+		p = *o.splitPolicy
+	}
+	if o.maxObjectsPerBucket != 0 {
+		p.MaxObjects = o.maxObjectsPerBucket
+	}
+
+	return p
+}
+
+func validateMaxBucketsCached(n int) error {
+	if n < 1 {
+		return fmt.Errorf("%w: max buckets cached must be positive but %d was specified", ErrInvalidOption, n)
+	}
+
+	return nil
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		maxBucketsCached: DefaultMaxBucketsCached,
+		lockPartitions:   DefaultLockPartitions,
+		dirPermissions:   DefaultDirPermissions,
+		filePermissions:  DefaultFilePermissions,
+		syncMode:         SyncFiles,
+		codec:            JSONCodec,
+		fileSystem:       OSFileSystem,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
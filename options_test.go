@@ -0,0 +1,264 @@
+package keva
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(value)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(encodedValue []byte, dest interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(encodedValue)).Decode(dest)
+}
+
+func TestOptions(t *testing.T) {
+
+	t.Run("WithCodec() encodes values with the given codec", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithCodec(gobCodec{}))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		value := testValue{Name: "apple", Colour: "red"}
+
+		err = s.Put("abc123", value)
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+		s.Close()
+
+		_, err = NewStore(rootPath)
+		if !errors.Is(err, ErrIncompatibleStore) {
+			t.Errorf("Expected ErrIncompatibleStore when reopening with a different codec but got %v", err)
+		}
+
+		s, err = NewStore(rootPath, WithCodec(gobCodec{}))
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+
+		var result testValue
+
+		err = s.Get("abc123", &result)
+		if err != nil {
+			t.Fatalf("Error when retrieving value: %v", err)
+		}
+		if result != value {
+			t.Errorf("Expected %v but got %v", value, result)
+		}
+	})
+
+	t.Run("WithFilePermissions() and WithDirPermissions() apply to created files", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		storePath := filepath.Join(rootPath, "store")
+
+		s, err := NewStore(storePath, WithDirPermissions(0750), WithFilePermissions(0640))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		fileInfo, err := os.Stat(storePath)
+		if err != nil {
+			t.Fatalf("Could not stat store: %v", err)
+		}
+		if perm := fileInfo.Mode().Perm(); perm != 0750 {
+			t.Errorf("Expected directory permissions %o but got %o", 0750, perm)
+		}
+
+		fileInfo, err = os.Stat(filepath.Join(storePath, manifestFileName))
+		if err != nil {
+			t.Fatalf("Could not stat manifest: %v", err)
+		}
+		if perm := fileInfo.Mode().Perm(); perm != 0640 {
+			t.Errorf("Expected file permissions %o but got %o", 0640, perm)
+		}
+
+		s.Destroy()
+	})
+
+	t.Run("WithMaxObjectsPerBucket() is persisted in the manifest", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(3), WithLockPartitions(1), WithSyncMode(SyncNone))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		s.Close()
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		if s.splitPolicy.MaxObjects != 3 {
+			t.Errorf("Expected max objects per bucket to be 3 but got %d", s.splitPolicy.MaxObjects)
+		}
+	})
+
+	t.Run("WithSplitPolicy() is persisted in the manifest", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		policy := SplitPolicy{MaxBytes: 4096}
+
+		s, err := NewStore(rootPath, WithSplitPolicy(policy))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		s.Close()
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		if result := s.SplitPolicy(); result != policy {
+			t.Errorf("Expected split policy %+v but got %+v", policy, result)
+		}
+	})
+
+	t.Run("WithMaxObjectsPerBucket() overrides the object limit of WithSplitPolicy()", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithSplitPolicy(SplitPolicy{MaxObjects: 10, MaxBytes: 4096}), WithMaxObjectsPerBucket(3))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		if result, expected := s.SplitPolicy(), (SplitPolicy{MaxObjects: 3, MaxBytes: 4096}); result != expected {
+			t.Errorf("Expected split policy %+v but got %+v", expected, result)
+		}
+	})
+
+	t.Run("WithBucketPathSegmentLength() and WithHashFunction() are persisted in the manifest", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithBucketPathSegmentLength(3), WithHashFunction(FNV1a128), WithMaxObjectsPerBucket(1))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+		s.Close()
+
+		entries, err := ioutil.ReadDir(rootPath)
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+		for _, entry := range entries {
+			if isBucketName(entry.Name()) && len(entry.Name()) != 3 {
+				t.Errorf("Expected bucket names of 3 characters but found '%s'", entry.Name())
+			}
+		}
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Close()
+
+		if s.storage.segmentLength != 3 {
+			t.Errorf("Expected bucket path segment length 3 but got %d", s.storage.segmentLength)
+		}
+		if s.hashFunction != FNV1a128 {
+			t.Errorf("Expected hash function '%s' but got '%s'", FNV1a128, s.hashFunction)
+		}
+
+		for i := 0; i < 100; i++ {
+			var result int
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	})
+
+	t.Run("NewStore() rejects a bucket layout differing from an existing store's", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		s.Close()
+
+		for _, opt := range []Option{WithBucketPathSegmentLength(3), WithHashFunction(FNV1a128)} {
+			_, err = NewStore(rootPath, opt)
+			if !errors.Is(err, ErrIncompatibleStore) {
+				t.Errorf("Expected ErrIncompatibleStore but got %v", err)
+			}
+		}
+	})
+
+	t.Run("NewStore() and OpenReadOnly() reject invalid option values", func(t *testing.T) {
+		rootPath := newTempDir(t)
+		defer os.RemoveAll(rootPath)
+
+		for _, opt := range []Option{
+			WithBucketPathSegmentLength(-1),
+			WithBucketPathSegmentLength(MaxBucketPathSegmentLength + 1),
+			WithHashFunction("md5"),
+			WithLockPartitions(0),
+			WithMaxBucketsCached(0),
+			WithMaxBucketsCached(-1),
+			WithMaxObjectsPerBucket(-1),
+			WithSplitPolicy(SplitPolicy{}),
+			WithSyncMode(SyncMode(-1)),
+			WithCodec(nil),
+			WithFileSystem(nil),
+		} {
+			_, err := NewStore(rootPath, opt)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("Expected ErrInvalidOption from NewStore() but got %v", err)
+			}
+
+			_, err = OpenReadOnly(rootPath, opt)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("Expected ErrInvalidOption from OpenReadOnly() but got %v", err)
+			}
+		}
+
+		entries, err := ioutil.ReadDir(rootPath)
+		if err != nil {
+			t.Fatalf("Error reading store location: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected nothing to be created but found %d entries", len(entries))
+		}
+	})
+}
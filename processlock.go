@@ -0,0 +1,57 @@
+package keva
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const lockFileName = "keva.lock"
+
+// ErrStoreLocked indicates that a store could not be opened because another
+// process, or another Store in this process, already has it open in an
+// incompatible mode.
+var ErrStoreLocked = errors.New("store is locked by another process")
+
+// acquireProcessLock takes an exclusive lock on the store's lock file, or a
+// shared lock if the store is being opened read-only. A read-only open never
+// creates the lock file; if it does not exist, no lock is taken. Neither is a
+// lock taken for stores on filesystems other than the operating system's.
+func acquireProcessLock(storage *bucketStorage, readOnly bool) (*os.File, error) {
+	if storage.fs != OSFileSystem {
+		return nil, nil
+	}
+
+	absFilePath := filepath.Join(storage.rootPath, lockFileName)
+
+	var file *os.File
+	var err error
+
+	if readOnly {
+		file, err = os.Open(absFilePath)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+	} else {
+		file, err = os.OpenFile(absFilePath, os.O_RDWR|os.O_CREATE, storage.filePermissions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file, !readOnly)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func releaseProcessLock(file *os.File) error {
+	if file == nil {
+		return nil
+	}
+
+	return file.Close()
+}
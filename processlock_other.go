@@ -0,0 +1,11 @@
+//go:build !unix
+
+package keva
+
+import "os"
+
+// Inter-process locking is only supported on Unix platforms; elsewhere the
+// lock file is created but not locked.
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
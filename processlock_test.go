@@ -0,0 +1,75 @@
+package keva
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestProcessLock(t *testing.T) {
+
+	t.Run("NewStore() fails while the store is open elsewhere", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-lock-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		_, err = NewStore(rootPath)
+		if err != ErrStoreLocked {
+			t.Errorf("Expected ErrStoreLocked but got %v", err)
+		}
+
+		_, err = OpenReadOnly(rootPath)
+		if err != ErrStoreLocked {
+			t.Errorf("Expected ErrStoreLocked for read-only open but got %v", err)
+		}
+
+		err = s.Close()
+		if err != nil {
+			t.Fatalf("Error closing store: %v", err)
+		}
+
+		s, err = NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Expected store to be reopened after closing but got %v", err)
+		}
+		s.Close()
+	})
+
+	t.Run("OpenReadOnly() allows other readers but not writers", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-lock-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		s.Close()
+
+		r1, err := OpenReadOnly(rootPath)
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+		defer r1.Close()
+
+		r2, err := OpenReadOnly(rootPath)
+		if err != nil {
+			t.Fatalf("Could not open second reader: %v", err)
+		}
+		defer r2.Close()
+
+		_, err = NewStore(rootPath)
+		if err != ErrStoreLocked {
+			t.Errorf("Expected ErrStoreLocked but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package keva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+
+	listFiles := func(rootPath string, t *testing.T) []string {
+		var files []string
+
+		err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error listing files: %v", err)
+		}
+
+		sort.Strings(files)
+		return files
+	}
+
+	t.Run("OpenReadOnly() allows reads but rejects writes", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-readonly-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(4))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		for i := 0; i < 50; i++ {
+			s.Put(fmt.Sprintf("key%d", i), i)
+		}
+		s.Close()
+
+		filesBefore := listFiles(rootPath, t)
+
+		r, err := OpenReadOnly(rootPath, WithMaxBucketsCached(2))
+		if err != nil {
+			t.Fatalf("Could not open store: %v", err)
+		}
+
+		for i := 0; i < 50; i++ {
+			var value int
+			err = r.Get(fmt.Sprintf("key%d", i), &value)
+			if err != nil {
+				t.Fatalf("Error retrieving value: %v", err)
+			}
+			if value != i {
+				t.Errorf("Expected %d but got %d", i, value)
+			}
+		}
+
+		if err := r.Put("key0", 100); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly from Put() but got %v", err)
+		}
+		if err := r.Remove("key0"); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly from Remove() but got %v", err)
+		}
+		if err := r.Flush(); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly from Flush() but got %v", err)
+		}
+		if err := r.Destroy(); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly from Destroy() but got %v", err)
+		}
+
+		_, err = Backup(r, ioutil.Discard, BackupManifest{})
+		if err != nil {
+			t.Fatalf("Error backing up read-only store: %v", err)
+		}
+
+		err = r.Close()
+		if err != nil {
+			t.Fatalf("Error closing store: %v", err)
+		}
+
+		filesAfter := listFiles(rootPath, t)
+
+		if fmt.Sprint(filesBefore) != fmt.Sprint(filesAfter) {
+			t.Errorf("Expected files to be unchanged but got %v instead of %v", filesAfter, filesBefore)
+		}
+	})
+
+	t.Run("OpenReadOnly() does not create a missing store", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-readonly-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		storePath := filepath.Join(rootPath, "missing")
+
+		_, err = OpenReadOnly(storePath)
+		if err == nil {
+			t.Errorf("Expected an error but got nothing")
+		}
+
+		_, err = os.Stat(storePath)
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected store location not to be created but got %v", err)
+		}
+	})
+}
+
+func TestOpenReadOnlyWithLiveUpdates(t *testing.T) {
+
+	t.Run("Get() reloads buckets replaced or split by a writer", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-readonly-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		w, err := NewStore(rootPath, WithMaxObjectsPerBucket(4))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer w.Close()
+
+		w.Put("key0", 0)
+		w.Flush()
+
+		r, err := OpenReadOnly(rootPath, WithLiveUpdates())
+		if err != nil {
+			t.Fatalf("Could not open store alongside writer: %v", err)
+		}
+		defer r.Close()
+
+		var value int
+
+		err = r.Get("key0", &value)
+		if err != nil {
+			t.Fatalf("Error retrieving value: %v", err)
+		}
+
+		w.Put("key0", 100)
+		for i := 1; i < 100; i++ {
+			w.Put(fmt.Sprintf("key%d", i), i)
+		}
+		w.Flush()
+
+		err = r.Get("key0", &value)
+		if err != nil {
+			t.Fatalf("Error retrieving value: %v", err)
+		}
+		if value != 100 {
+			t.Errorf("Expected updated value 100 but got %d", value)
+		}
+
+		for i := 1; i < 100; i++ {
+			err = r.Get(fmt.Sprintf("key%d", i), &value)
+			if err != nil {
+				t.Fatalf("Error retrieving value: %v", err)
+			}
+			if value != i {
+				t.Errorf("Expected %d but got %d", i, value)
+			}
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package keva
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// splitSuffix is appended to a bucket's file name to name the temporary
+// directory its children are written to while it is split.
+const splitSuffix = ".tmp"
+
+// replacementSuffix and replacedSuffix are appended to the name of a bucket or
+// directory of buckets being rewritten by a merge or reshard, to name its
+// replacement while it is written, and the original while the replacement is
+// swapped in.
+const (
+	replacementSuffix = ".new"
+	replacedSuffix    = ".old"
+)
+
+// recoverLayout finishes any splits, merges or reshards of buckets which were
+// interrupted by a crash, in the directory at absDirPath and beneath it.
+//
+// A split's temporary directory replaces its bucket's file if the file had
+// already been removed, and is otherwise discarded, as the bucket's file still
+// holds all of its objects. Likewise, the replacement written by a merge or
+// reshard is swapped in if the original had already been moved aside, and is
+// otherwise discarded.
+func recoverLayout(storage *bucketStorage, absDirPath string) error {
+	entries, err := storage.ReadDir(absDirPath)
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[string]bool)
+	for _, entry := range entries {
+		exists[entry.Name()] = true
+	}
+
+	// Replacements sort before the originals they replace, which are dealt
+	// with once it is known whether the replacement was swapped in.
+
+	for _, entry := range entries {
+		name := entry.Name()
+		absPath := filepath.Join(absDirPath, name)
+
+		bucketName, suffix := splitLayoutName(name)
+		if bucketName == "" {
+			continue
+		}
+
+		absBucketPath := filepath.Join(absDirPath, bucketName)
+
+		switch {
+		case suffix == "":
+			if entry.IsDir() {
+				err = recoverLayout(storage, absPath)
+			}
+
+		case exists[bucketName]:
+			err = storage.RemoveAll(absPath)
+
+		case suffix == splitSuffix, suffix == replacementSuffix, suffix == replacedSuffix:
+			err = storage.Rename(absPath, absBucketPath)
+			if err == nil {
+				exists[bucketName] = true
+
+				if entry.IsDir() {
+					err = recoverLayout(storage, absBucketPath)
+				}
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitLayoutName returns the bucket name and recovery suffix of an entry in a
+// store's directory, or an empty bucket name if the entry is neither a bucket
+// nor left by an interrupted split, merge or reshard.
+func splitLayoutName(name string) (bucketName, suffix string) {
+	for _, suffix := range []string{"", splitSuffix, replacementSuffix, replacedSuffix} {
+		if bucketName := strings.TrimSuffix(name, suffix); (suffix == "" || bucketName != name) && isBucketName(bucketName) {
+			return bucketName, suffix
+		}
+	}
+
+	return "", ""
+}
@@ -0,0 +1,262 @@
+package keva
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoverSplits(t *testing.T) {
+
+	newSplitStore := func(t *testing.T) (*Store, string) {
+		rootPath, err := ioutil.TempDir("", "keva-recovery-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(1))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			err = s.Put(string(rune('a'+i%26))+string(rune('a'+i/26)), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		err = s.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		entries, err := ioutil.ReadDir(rootPath)
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				return s, entry.Name()
+			}
+		}
+
+		t.Fatalf("Expected store to contain a split bucket")
+		return nil, ""
+	}
+
+	expectAllValues := func(rootPath string, t *testing.T) {
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Destroy()
+
+		for i := 0; i < 100; i++ {
+			var result int
+
+			err := s.Get(string(rune('a'+i%26))+string(rune('a'+i/26)), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	}
+
+	t.Run("NewStore() completes splits whose bucket file was removed", func(t *testing.T) {
+		s, name := newSplitStore(t)
+
+		absPath := filepath.Join(s.rootPath, name)
+
+		err := os.Rename(absPath, absPath+splitSuffix)
+		if err != nil {
+			t.Fatalf("Error simulating interrupted split: %v", err)
+		}
+
+		expectAllValues(s.rootPath, t)
+
+		if _, err := os.Stat(absPath + splitSuffix); !os.IsNotExist(err) {
+			t.Errorf("Expected temporary split directory to be gone but got %v", err)
+		}
+	})
+
+	t.Run("NewStore() discards splits whose bucket file remains", func(t *testing.T) {
+		s, name := newSplitStore(t)
+
+		absPath := filepath.Join(s.rootPath, name)
+
+		err := os.Mkdir(absPath+splitSuffix, 0700)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(absPath+splitSuffix, "00"), []byte("{}\n"), 0600)
+		}
+		if err != nil {
+			t.Fatalf("Error simulating interrupted split: %v", err)
+		}
+
+		expectAllValues(s.rootPath, t)
+
+		if _, err := os.Stat(absPath + splitSuffix); !os.IsNotExist(err) {
+			t.Errorf("Expected temporary split directory to be removed but got %v", err)
+		}
+	})
+}
+
+func TestRecoverMerges(t *testing.T) {
+
+	newMergeStore := func(t *testing.T) (*Store, string) {
+		rootPath, err := ioutil.TempDir("", "keva-recovery-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(1))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			err = s.Put(string(rune('a'+i%26))+string(rune('a'+i/26)), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		err = s.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		entries, err := ioutil.ReadDir(rootPath)
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			absPath := filepath.Join(rootPath, entry.Name())
+			objects := make(map[string][]byte)
+
+			err = walkBucketFiles(s.storage, absPath, func(absFilePath string) error {
+				bucketObjects, err := loadObjects(s.storage, absFilePath)
+				for key, encodedValue := range bucketObjects {
+					objects[key] = encodedValue
+				}
+				return err
+			})
+			if err == nil {
+				err = saveObjects(s.storage, absPath+replacementSuffix, objects)
+			}
+			if err != nil {
+				t.Fatalf("Error simulating interrupted merge: %v", err)
+			}
+
+			return s, entry.Name()
+		}
+
+		t.Fatalf("Expected store to contain a split bucket")
+		return nil, ""
+	}
+
+	expectAllValues := func(rootPath string, t *testing.T) {
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		defer s.Destroy()
+
+		for i := 0; i < 100; i++ {
+			var result int
+
+			err := s.Get(string(rune('a'+i%26))+string(rune('a'+i/26)), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	}
+
+	expectGone := func(absPath string, t *testing.T) {
+		if _, err := os.Stat(absPath); !os.IsNotExist(err) {
+			t.Errorf("Expected '%s' to be gone but got %v", filepath.Base(absPath), err)
+		}
+	}
+
+	t.Run("NewStore() discards merges whose directory remains", func(t *testing.T) {
+		s, name := newMergeStore(t)
+
+		absPath := filepath.Join(s.rootPath, name)
+
+		expectAllValues(s.rootPath, t)
+		expectGone(absPath+replacementSuffix, t)
+	})
+
+	t.Run("NewStore() completes merges whose directory was moved aside", func(t *testing.T) {
+		s, name := newMergeStore(t)
+
+		absPath := filepath.Join(s.rootPath, name)
+
+		err := os.Rename(absPath, absPath+replacedSuffix)
+		if err != nil {
+			t.Fatalf("Error simulating interrupted merge: %v", err)
+		}
+
+		defer os.RemoveAll(s.rootPath)
+
+		reopened, err := NewStore(s.rootPath)
+		if err != nil {
+			t.Fatalf("Could not reopen store: %v", err)
+		}
+		reopened.Close()
+
+		if fileInfo, err := os.Stat(absPath); err != nil || fileInfo.IsDir() {
+			t.Errorf("Expected merged bucket to replace directory but got %v", err)
+		}
+
+		expectAllValues(s.rootPath, t)
+		expectGone(absPath+replacementSuffix, t)
+		expectGone(absPath+replacedSuffix, t)
+	})
+
+	t.Run("NewStore() removes directories left behind by completed merges", func(t *testing.T) {
+		s, name := newMergeStore(t)
+
+		absPath := filepath.Join(s.rootPath, name)
+
+		err := os.Rename(absPath, absPath+replacedSuffix)
+		if err == nil {
+			err = os.Rename(absPath+replacementSuffix, absPath)
+		}
+		if err != nil {
+			t.Fatalf("Error simulating interrupted merge: %v", err)
+		}
+
+		expectAllValues(s.rootPath, t)
+		expectGone(absPath+replacedSuffix, t)
+	})
+
+	t.Run("NewStore() restores directories moved aside before their merged bucket was written", func(t *testing.T) {
+		s, name := newMergeStore(t)
+
+		absPath := filepath.Join(s.rootPath, name)
+
+		err := os.Remove(absPath + replacementSuffix)
+		if err == nil {
+			err = os.Rename(absPath, absPath+replacedSuffix)
+		}
+		if err != nil {
+			t.Fatalf("Error simulating interrupted merge: %v", err)
+		}
+
+		expectAllValues(s.rootPath, t)
+		expectGone(absPath+replacedSuffix, t)
+	})
+}
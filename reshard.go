@@ -0,0 +1,212 @@
+package keva
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReshardProgress describes how far ReshardOnline has got. The store's
+// top-level buckets and directories of buckets are resharded one at a time,
+// and Done counts those finished out of Total.
+type ReshardProgress struct {
+	Done  int
+	Total int
+}
+
+// Reshard copies the store at srcPath into a new store at destPath, which
+// must either not exist or be an empty directory, laying out its buckets
+// afresh according to the given options. Options such as WithCodec and
+// WithFileSystem are also used to open the source store, which is opened with
+// OpenReadOnly and so must not be open elsewhere for writing.
+//
+// Objects belonging to namespaces are copied along with the namespaces
+// themselves. If resharding fails, whatever it wrote to the destination is
+// removed, along with destPath itself if Reshard created it.
+func Reshard(srcPath, destPath string, opts ...Option) error {
+	src, err := OpenReadOnly(srcPath, opts...)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	storage := newBucketStorage(destPath, newOptions(opts))
+
+	entries, err := storage.ReadDir(destPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	destExisted := err == nil
+	if len(entries) > 0 {
+		return fmt.Errorf("reshard destination '%s' is not empty", destPath)
+	}
+
+	dest, err := NewStore(destPath, opts...)
+	if err != nil {
+		if !destExisted {
+			storage.RemoveAll(destPath)
+		}
+		return err
+	}
+
+	err = reshardInto(dest, src)
+	if err != nil {
+		dest.destroy(destExisted)
+		return err
+	}
+
+	return dest.Close()
+}
+
+// ReshardOnline changes the store's split policy and rewrites its existing
+// buckets to match, splitting buckets which exceed the policy and merging
+// those which fit within it. Unlike SetSplitPolicy, which only affects future
+// splits, this brings the whole store into line with the new policy.
+//
+// Pending changes are flushed first, and the store remains available while it
+// is resharded. Each top-level bucket or directory of buckets is rewritten in
+// turn, holding off operations on keys belonging to it only while it is
+// rewritten, after which progress, if not nil, is called. If ctx is done,
+// resharding stops between buckets and returns the context's error, leaving
+// the store partly resharded but consistent.
+func (s *Store) ReshardOnline(ctx context.Context, policy SplitPolicy, progress func(ReshardProgress)) error {
+	err := s.SetSplitPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	err = s.FlushContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	names, err := bucketNames(s.storage, s.rootPath)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		err = s.reshardBucketTree(ctx, bucketPath(name))
+		if err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(ReshardProgress{Done: i + 1, Total: len(names)})
+		}
+	}
+
+	return nil
+}
+
+// reshardBucketTree rewrites the top-level bucket or directory of buckets at
+// path according to the store's split policy.
+func (s *Store) reshardBucketTree(ctx context.Context, path bucketPath) (err error) {
+	s.mutationLock.RLock()
+	defer s.mutationLock.RUnlock()
+
+	lockErr := withSymbolLock(ctx, s.bucketLock, string(path), func() {
+		s.storeLock.Lock()
+		policy := s.splitPolicy
+		err = s.cache.evictUnder(path, s.storage)
+		s.storeLock.Unlock()
+
+		if err != nil {
+			return
+		}
+
+		defer s.invalidateDigests(path)
+
+		s.storage.saving.RLock()
+		defer s.storage.saving.RUnlock()
+
+		absPath := s.storage.AbsPath(path)
+		objects := make(map[string][]byte)
+
+		err = walkBucketFiles(s.storage, absPath, func(absFilePath string) error {
+			bucketObjects, err := loadObjects(s.storage, absFilePath)
+			for key, encodedValue := range bucketObjects {
+				objects[key] = encodedValue
+			}
+			return err
+		})
+		if err != nil {
+			return
+		}
+
+		if len(objects) == 0 {
+			err = s.storage.RemoveAll(absPath)
+			return
+		}
+
+		err = replaceBucketTree(s.storage, absPath, func(absNewPath string) error {
+			return writeBucketTree(s.storage, absNewPath, len(path), objects, policy, s.bucketIDForKey)
+		})
+	})
+	if lockErr != nil {
+		return lockErr
+	}
+
+	return
+}
+
+// reshardInto copies every object and namespace of src into dest.
+func reshardInto(dest, src *Store) error {
+	err := copyNamespaces(dest, src)
+	if err != nil {
+		return err
+	}
+
+	return src.forEachObject(func(key string, encodedValue []byte) error {
+		return dest.putEncoded(context.Background(), key, encodedValue)
+	})
+}
+
+// writeBucketTree writes objects as a bucket at absPath, or as a directory of
+// buckets if they exceed policy, splitting them on the segments of their IDs
+// following the first pathLength characters.
+func writeBucketTree(storage *bucketStorage, absPath string, pathLength int, objects map[string][]byte, policy SplitPolicy, bucketIDForKey func(string) string) error {
+	if !policy.exceeded(len(objects), objectsSize(objects)) {
+		return saveObjects(storage, absPath, objects)
+	}
+
+	children := make(map[string]map[string][]byte)
+
+	for key, encodedValue := range objects {
+		step, _ := bucketPath(bucketIDForKey(key)[pathLength:]).Step(storage.segmentLength)
+
+		// Objects whose whole IDs are already used by the path can't be
+		// split any further.
+
+		if step == "" {
+			return saveObjects(storage, absPath, objects)
+		}
+
+		if children[step] == nil {
+			children[step] = make(map[string][]byte)
+		}
+		children[step][key] = encodedValue
+	}
+
+	err := storage.Mkdir(absPath)
+	if err != nil {
+		return err
+	}
+
+	for step, childObjects := range children {
+		err = writeBucketTree(storage, filepath.Join(absPath, step), pathLength+len(step), childObjects, policy, bucketIDForKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,341 @@
+package keva
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestReshard(t *testing.T) {
+
+	countDirs := func(rootPath string, t *testing.T) int {
+		count := 0
+
+		err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() && path != rootPath {
+				count++
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		return count
+	}
+
+	newPopulatedStore := func(rootPath string, t *testing.T, opts ...Option) *Store {
+		s, err := NewStore(rootPath, opts...)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		for i := 0; i < 200; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		return s
+	}
+
+	expectAllValues := func(s *Store, t *testing.T) {
+		for i := 0; i < 200; i++ {
+			var result int
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	}
+
+	t.Run("Reshard() copies a store into a new layout", func(t *testing.T) {
+		srcPath := newTempDir(t)
+		defer os.RemoveAll(srcPath)
+
+		src := newPopulatedStore(srcPath, t, WithMaxObjectsPerBucket(1))
+
+		ns, err := src.Namespace("things")
+		if err == nil {
+			err = ns.Put("key0", "namespaced")
+		}
+		if err != nil {
+			t.Fatalf("Error when storing namespaced value: %v", err)
+		}
+
+		err = src.Close()
+		if err != nil {
+			t.Fatalf("Error when closing store: %v", err)
+		}
+
+		destPath := filepath.Join(newTempDir(t), "dest")
+		defer os.RemoveAll(filepath.Dir(destPath))
+
+		err = Reshard(srcPath, destPath, WithMaxObjectsPerBucket(DefaultMaxObjectsPerBucket))
+		if err != nil {
+			t.Fatalf("Error when resharding store: %v", err)
+		}
+
+		if result := countDirs(destPath, t); result != 0 {
+			t.Errorf("Expected no split buckets but found %d directories", result)
+		}
+		if countDirs(srcPath, t) == 0 {
+			t.Errorf("Expected source store to be left as it was")
+		}
+
+		dest, err := NewStore(destPath)
+		if err != nil {
+			t.Fatalf("Could not open resharded store: %v", err)
+		}
+		defer dest.Close()
+
+		expectAllValues(dest, t)
+
+		ns, err = dest.Namespace("things")
+		if err != nil {
+			t.Fatalf("Error opening namespace: %v", err)
+		}
+
+		var value string
+
+		err = ns.Get("key0", &value)
+		if err != nil {
+			t.Fatalf("Error when retrieving namespaced value: %v", err)
+		}
+		if value != "namespaced" {
+			t.Errorf("Expected 'namespaced' but got '%s'", value)
+		}
+	})
+
+	t.Run("Reshard() can change the bucket layout", func(t *testing.T) {
+		srcPath := newTempDir(t)
+		defer os.RemoveAll(srcPath)
+
+		src := newPopulatedStore(srcPath, t, WithMaxObjectsPerBucket(1))
+		src.Close()
+
+		destPath := filepath.Join(newTempDir(t), "dest")
+		defer os.RemoveAll(filepath.Dir(destPath))
+
+		err := Reshard(srcPath, destPath, WithBucketPathSegmentLength(1), WithHashFunction(FNV1a128))
+		if err != nil {
+			t.Fatalf("Error when resharding store: %v", err)
+		}
+
+		dest, err := NewStore(destPath)
+		if err != nil {
+			t.Fatalf("Could not open resharded store: %v", err)
+		}
+		defer dest.Close()
+
+		if dest.storage.segmentLength != 1 || dest.hashFunction != FNV1a128 {
+			t.Errorf("Expected new layout but got segment length %d and hash function '%s'", dest.storage.segmentLength, dest.hashFunction)
+		}
+
+		expectAllValues(dest, t)
+	})
+
+	t.Run("Reshard() rejects a destination which is not empty", func(t *testing.T) {
+		srcPath := newTempDir(t)
+		defer os.RemoveAll(srcPath)
+
+		src := newPopulatedStore(srcPath, t)
+		src.Close()
+
+		destPath := newTempDir(t)
+		defer os.RemoveAll(destPath)
+
+		err := ioutil.WriteFile(filepath.Join(destPath, "something"), nil, 0600)
+		if err != nil {
+			t.Fatalf("Error creating file: %v", err)
+		}
+
+		err = Reshard(srcPath, destPath)
+		if err == nil {
+			t.Errorf("Expected an error but got nothing")
+		}
+	})
+
+	t.Run("Reshard() removes only what it created when it fails", func(t *testing.T) {
+		srcPath := newTempDir(t)
+		defer os.RemoveAll(srcPath)
+
+		src := newPopulatedStore(srcPath, t)
+		src.Close()
+
+		// Corrupt a bucket so that copying its objects fails.
+
+		err := filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && isBucketName(info.Name()) {
+				err = ioutil.WriteFile(path, []byte("corrupt"), 0600)
+				if err == nil {
+					err = filepath.SkipAll
+				}
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error corrupting bucket: %v", err)
+		}
+
+		parentPath := newTempDir(t)
+		defer os.RemoveAll(parentPath)
+
+		createdPath := filepath.Join(parentPath, "created")
+
+		err = Reshard(srcPath, createdPath)
+		if err == nil {
+			t.Fatalf("Expected an error but got nothing")
+		}
+		if _, err := os.Stat(createdPath); !os.IsNotExist(err) {
+			t.Errorf("Expected destination created by Reshard() to be removed but got %v", err)
+		}
+
+		existingPath := filepath.Join(parentPath, "existing")
+
+		err = os.Mkdir(existingPath, 0750)
+		if err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+
+		err = Reshard(srcPath, existingPath)
+		if err == nil {
+			t.Fatalf("Expected an error but got nothing")
+		}
+
+		fileInfo, err := os.Stat(existingPath)
+		if err != nil {
+			t.Fatalf("Expected existing destination to be kept but got %v", err)
+		}
+		if perm := fileInfo.Mode().Perm(); perm != 0750 {
+			t.Errorf("Expected permissions %o to be kept but got %o", 0750, perm)
+		}
+
+		entries, err := ioutil.ReadDir(existingPath)
+		if err != nil {
+			t.Fatalf("Error reading destination: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected existing destination to be emptied but found %d entries", len(entries))
+		}
+	})
+
+	t.Run("ReshardOnline() rewrites buckets to match the new policy", func(t *testing.T) {
+		rootPath := newTempDir(t)
+
+		s := newPopulatedStore(rootPath, t)
+		defer s.Destroy()
+
+		var progress []ReshardProgress
+
+		err := s.ReshardOnline(context.Background(), SplitPolicy{MaxObjects: 1}, func(p ReshardProgress) {
+			progress = append(progress, p)
+		})
+		if err != nil {
+			t.Fatalf("Error when resharding store: %v", err)
+		}
+
+		if len(progress) == 0 {
+			t.Fatalf("Expected progress to be reported")
+		}
+		for i, p := range progress {
+			if p.Done != i+1 || p.Total != len(progress) {
+				t.Errorf("Expected progress %d of %d but got %+v", i+1, len(progress), p)
+			}
+		}
+
+		err = walkBucketFiles(s.storage, rootPath, func(absFilePath string) error {
+			objects, err := loadObjects(s.storage, absFilePath)
+			if err == nil && len(objects) > 1 {
+				t.Errorf("Expected bucket '%s' to hold at most 1 object but found %d", absFilePath, len(objects))
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		expectAllValues(s, t)
+
+		err = s.ReshardOnline(context.Background(), SplitPolicy{MaxObjects: DefaultMaxObjectsPerBucket}, nil)
+		if err != nil {
+			t.Fatalf("Error when resharding store: %v", err)
+		}
+
+		if result := countDirs(rootPath, t); result != 0 {
+			t.Errorf("Expected no split buckets but found %d directories", result)
+		}
+
+		expectAllValues(s, t)
+	})
+
+	t.Run("ReshardOnline() allows concurrent writes", func(t *testing.T) {
+		rootPath := newTempDir(t)
+
+		s := newPopulatedStore(rootPath, t)
+		defer s.Destroy()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 200; i < 400; i++ {
+				err := s.Put(fmt.Sprintf("key%d", i), i)
+				if err != nil {
+					t.Errorf("Error when storing value: %v", err)
+					return
+				}
+			}
+		}()
+
+		err := s.ReshardOnline(context.Background(), SplitPolicy{MaxObjects: 2}, nil)
+		if err != nil {
+			t.Fatalf("Error when resharding store: %v", err)
+		}
+
+		wg.Wait()
+
+		expectAllValues(s, t)
+
+		for i := 200; i < 400; i++ {
+			var result int
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	})
+
+	t.Run("ReshardOnline() stops when the context is done", func(t *testing.T) {
+		rootPath := newTempDir(t)
+
+		s := newPopulatedStore(rootPath, t)
+		defer s.Destroy()
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := s.ReshardOnline(ctx, SplitPolicy{MaxObjects: 1}, func(p ReshardProgress) {
+			cancel()
+		})
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled but got %v", err)
+		}
+
+		expectAllValues(s, t)
+	})
+}
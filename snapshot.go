@@ -0,0 +1,141 @@
+package keva
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot creates a consistent point-in-time copy of the store at destPath,
+// which must either not exist or be an empty directory. The result can be
+// opened with NewStore as an independent store.
+//
+// Pending changes are flushed, and bucket files are then hard linked into the
+// snapshot where possible, or copied otherwise. Because buckets are always
+// saved by writing a new file and renaming it into place, a bucket modified
+// after the snapshot is taken gets a new file and the snapshot's link keeps
+// the original contents.
+//
+// Gets and Puts continue while bucket files are linked or copied, but no
+// bucket is saved until the snapshot completes. Operations which must save a
+// bucket, such as Flush or a Get or Put which evicts a changed bucket from
+// the cache, wait for it, as do operations which rewrite many buckets, such as
+// Compact. Other operations using the same cache may also wait behind an
+// eviction.
+func (s *Store) Snapshot(destPath string) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	s.mutationLock.RLock()
+	defer s.mutationLock.RUnlock()
+
+	err = s.holdSavesAfterFlush(destPath)
+	if err != nil {
+		return err
+	}
+	defer s.storage.saving.Unlock()
+
+	return linkTree(s.storage, s.rootPath, destPath)
+}
+
+// holdSavesAfterFlush flushes pending changes, prepares destPath and copies
+// the manifest to it for a snapshot, then holds off bucket saves so that the
+// store's files stay as they are while they are linked. Saves are held off only if no
+// error is returned.
+func (s *Store) holdSavesAfterFlush(destPath string) error {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	err := s.flushLocked()
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.storage.ReadDir(destPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("snapshot destination '%s' is not empty", destPath)
+	}
+
+	err = s.storage.MkdirAll(destPath)
+	if err != nil {
+		return err
+	}
+
+	err = copyFile(s.storage, filepath.Join(s.rootPath, manifestFileName), filepath.Join(destPath, manifestFileName))
+	if err != nil {
+		return err
+	}
+
+	// Changes can't be marked without the store lock, so no Put or Remove
+	// has completed since the flush. Any bucket evicted and saved meanwhile
+	// holds only changes from operations still in progress, which may as well
+	// have preceded the snapshot.
+
+	s.storage.saving.Lock()
+	return nil
+}
+
+func copyFile(storage *bucketStorage, srcPath, destPath string) error {
+	src, err := storage.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := storage.CreateFile(destPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dest, src)
+	if err != nil {
+		dest.Close()
+		return err
+	}
+
+	err = storage.SyncFile(dest)
+	if err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+func linkTree(storage *bucketStorage, srcDirPath, destDirPath string) error {
+	entries, err := storage.ReadDir(srcDirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !isBucketName(entry.Name()) {
+			continue
+		}
+
+		srcPath := filepath.Join(srcDirPath, entry.Name())
+		destPath := filepath.Join(destDirPath, entry.Name())
+
+		if entry.IsDir() {
+			err = storage.Mkdir(destPath)
+			if err == nil {
+				err = linkTree(storage, srcPath, destPath)
+			}
+		} else if storage.Link(srcPath, destPath) != nil {
+			err = copyFile(storage, srcPath, destPath)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return storage.SyncDir(destDirPath)
+}
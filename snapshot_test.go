@@ -0,0 +1,181 @@
+package keva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingFileSystem struct {
+	FileSystem
+	blockPrefix string
+	blocked     chan struct{}
+	release     chan struct{}
+	once        sync.Once
+}
+
+func (fs *blockingFileSystem) Create(name string, perm os.FileMode) (File, error) {
+	if fs.blockPrefix != "" && strings.HasPrefix(name, fs.blockPrefix) && filepath.Base(name) != manifestFileName {
+		fs.once.Do(func() { close(fs.blocked) })
+		<-fs.release
+	}
+
+	return fs.FileSystem.Create(name, perm)
+}
+
+func TestSnapshot(t *testing.T) {
+
+	t.Run("Snapshot() creates an independent copy of the store", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-snapshot-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(filepath.Join(rootPath, "store"))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		s.SetMaxObjectsPerBucket(4)
+
+		for i := 0; i < 100; i++ {
+			s.Put(fmt.Sprintf("key%d", i), i)
+		}
+
+		snapshotPath := filepath.Join(rootPath, "snapshot")
+
+		err = s.Snapshot(snapshotPath)
+		if err != nil {
+			t.Fatalf("Error taking snapshot: %v", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			s.Put(fmt.Sprintf("key%d", i), -i)
+		}
+		s.Put("newKey", 1)
+		s.Flush()
+
+		snapshot, err := NewStore(snapshotPath)
+		if err != nil {
+			t.Fatalf("Could not open snapshot: %v", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			var value int
+			err = snapshot.Get(fmt.Sprintf("key%d", i), &value)
+			if err != nil {
+				t.Fatalf("Error retrieving value from snapshot: %v", err)
+			}
+			if value != i {
+				t.Errorf("Expected snapshot value %d but got %d", i, value)
+			}
+		}
+
+		var value int
+		err = snapshot.Get("newKey", &value)
+		if err != ErrValueNotFound {
+			t.Errorf("Expected ErrValueNotFound for key added after snapshot but got %v", err)
+		}
+	})
+
+	t.Run("Snapshot() fails when destination is not empty", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-snapshot-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		s, err := NewStore(filepath.Join(rootPath, "store"))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+
+		err = s.Snapshot(rootPath)
+		if err == nil {
+			t.Errorf("Expected an error but got nothing")
+		}
+	})
+
+	t.Run("Snapshot() lets cached gets and puts continue while files are copied", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-snapshot-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+		defer os.RemoveAll(rootPath)
+
+		snapshotPath := filepath.Join(rootPath, "snapshot")
+
+		fs := &blockingFileSystem{FileSystem: OSFileSystem, blocked: make(chan struct{}), release: make(chan struct{})}
+
+		s, err := NewStore(filepath.Join(rootPath, "store"), WithFileSystem(fs))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Close()
+
+		for i := 0; i < 10; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		fs.blockPrefix = snapshotPath
+
+		snapshotErr := make(chan error)
+		go func() {
+			snapshotErr <- s.Snapshot(snapshotPath)
+		}()
+
+		<-fs.blocked
+
+		done := make(chan error)
+		go func() {
+			var value int
+
+			err := s.Put("key1", -1)
+			if err == nil {
+				err = s.Get("key2", &value)
+			}
+			done <- err
+		}()
+
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Errorf("Error when accessing store during snapshot: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected gets and puts to continue during snapshot")
+		}
+
+		close(fs.release)
+
+		err = <-snapshotErr
+		if err != nil {
+			t.Fatalf("Error taking snapshot: %v", err)
+		}
+
+		snapshot, err := NewStore(snapshotPath)
+		if err != nil {
+			t.Fatalf("Could not open snapshot: %v", err)
+		}
+		defer snapshot.Close()
+
+		var value int
+
+		err = snapshot.Get("key1", &value)
+		if err != nil {
+			t.Fatalf("Error retrieving value from snapshot: %v", err)
+		}
+		if value != 1 {
+			t.Errorf("Expected snapshot value 1 but got %d", value)
+		}
+	})
+}
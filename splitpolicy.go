@@ -0,0 +1,66 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidSplitPolicy indicates that a split policy sets no limits, or a
+// negative one.
+var ErrInvalidSplitPolicy = errors.New("invalid split policy")
+
+// SplitPolicy determines when a bucket is split. A bucket is split once it
+// exceeds either of the limits which are set, so buckets may be split by
+// object count, by size, or by both.
+type SplitPolicy struct {
+	// MaxObjects is the number of objects a bucket may hold before it is
+	// split, or zero for no limit.
+	MaxObjects int
+
+	// MaxBytes is the total size of the keys and encoded values a bucket may
+	// hold before it is split, or zero for no limit. Bucket files are
+	// somewhat larger than this, as they also hold the encoding overhead of
+	// their objects. A bucket holding a single object larger than this is
+	// not split.
+	MaxBytes int64
+}
+
+// Validate returns an error wrapping ErrInvalidSplitPolicy if the policy sets
+// no limits, or a negative one.
+func (p SplitPolicy) Validate() error {
+	if p.MaxObjects < 0 || p.MaxBytes < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidSplitPolicy)
+	}
+	if p.MaxObjects == 0 && p.MaxBytes == 0 {
+		return fmt.Errorf("%w: at least one limit must be set", ErrInvalidSplitPolicy)
+	}
+
+	return nil
+}
+
+// allowsMerge indicates whether buckets together holding the given number and
+// size of objects are small enough for Compact to merge, leaving room for the
+// merged bucket to grow before it needs splitting again.
+func (p SplitPolicy) allowsMerge(objectCount int, size int64) bool {
+	return (p.MaxObjects == 0 || objectCount <= p.MaxObjects/2) &&
+		(p.MaxBytes == 0 || size <= p.MaxBytes/2)
+}
+
+// exceeded indicates whether a bucket holding the given number and size of
+// objects needs splitting.
+func (p SplitPolicy) exceeded(objectCount int, size int64) bool {
+	return p.MaxObjects != 0 && objectCount > p.MaxObjects ||
+		p.MaxBytes != 0 && size > p.MaxBytes && objectCount > 1
+}
+
+// objectsSize returns the total size of the keys and encoded values of the
+// given objects, as limited by SplitPolicy.MaxBytes.
+func objectsSize(objects map[string][]byte) int64 {
+	var size int64
+
+	for key, encodedValue := range objects {
+		size += int64(len(key) + len(encodedValue))
+	}
+
+	return size
+}
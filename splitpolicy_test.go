@@ -0,0 +1,166 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitPolicy(t *testing.T) {
+
+	countDirs := func(rootPath string, t *testing.T) int {
+		count := 0
+
+		err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() && path != rootPath {
+				count++
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		return count
+	}
+
+	t.Run("Validate() rejects policies without limits or with negative limits", func(t *testing.T) {
+		for _, p := range []SplitPolicy{{}, {MaxObjects: -1}, {MaxObjects: 1, MaxBytes: -1}} {
+			if err := p.Validate(); !errors.Is(err, ErrInvalidSplitPolicy) {
+				t.Errorf("Expected ErrInvalidSplitPolicy for %+v but got %v", p, err)
+			}
+		}
+
+		for _, p := range []SplitPolicy{{MaxObjects: 1}, {MaxBytes: 1}, {MaxObjects: 1, MaxBytes: 1}} {
+			if err := p.Validate(); err != nil {
+				t.Errorf("Expected %+v to be valid but got %v", p, err)
+			}
+		}
+	})
+
+	t.Run("exceeded() applies whichever limits are set", func(t *testing.T) {
+		cases := []struct {
+			policy      SplitPolicy
+			objectCount int
+			size        int64
+			expected    bool
+		}{
+			{SplitPolicy{MaxObjects: 4}, 4, 1 << 30, false},
+			{SplitPolicy{MaxObjects: 4}, 5, 0, true},
+			{SplitPolicy{MaxBytes: 100}, 1000, 100, false},
+			{SplitPolicy{MaxBytes: 100}, 2, 101, true},
+			{SplitPolicy{MaxBytes: 100}, 1, 1000, false},
+			{SplitPolicy{MaxObjects: 4, MaxBytes: 100}, 5, 10, true},
+			{SplitPolicy{MaxObjects: 4, MaxBytes: 100}, 2, 101, true},
+			{SplitPolicy{MaxObjects: 4, MaxBytes: 100}, 4, 100, false},
+		}
+
+		for _, c := range cases {
+			if result := c.policy.exceeded(c.objectCount, c.size); result != c.expected {
+				t.Errorf("Expected %+v with %d objects of %d bytes to give %v but got %v", c.policy, c.objectCount, c.size, c.expected, result)
+			}
+		}
+	})
+
+	t.Run("Put() splits buckets by size", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-splitpolicy-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithSplitPolicy(SplitPolicy{MaxBytes: 1024}))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Destroy()
+
+		value := strings.Repeat("x", 600)
+
+		for i := 0; i < 200; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), value)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		err = s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		if countDirs(rootPath, t) == 0 {
+			t.Errorf("Expected buckets to have been split by size")
+		}
+
+		err = walkBucketFiles(s.storage, rootPath, func(absFilePath string) error {
+			objects, err := loadObjects(s.storage, absFilePath)
+			if err == nil && len(objects) > 1 && objectsSize(objects) > 1024 {
+				t.Errorf("Expected bucket '%s' to have been split but it holds %d bytes", absFilePath, objectsSize(objects))
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+
+		for i := 0; i < 200; i++ {
+			var result string
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != value {
+				t.Errorf("Expected value %d to be roundtripped", i)
+			}
+		}
+	})
+
+	t.Run("Put() does not split buckets holding a single oversized object", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-splitpolicy-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithSplitPolicy(SplitPolicy{MaxBytes: 16}))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Destroy()
+
+		err = s.Put("key", strings.Repeat("x", 100))
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+
+		if result := countDirs(rootPath, t); result != 0 {
+			t.Errorf("Expected no splits but found %d directories", result)
+		}
+	})
+
+	t.Run("SetSplitPolicy() rejects invalid policies", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-splitpolicy-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath)
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Destroy()
+
+		err = s.SetSplitPolicy(SplitPolicy{})
+		if !errors.Is(err, ErrInvalidSplitPolicy) {
+			t.Errorf("Expected ErrInvalidSplitPolicy but got %v", err)
+		}
+
+		if result, expected := s.SplitPolicy(), (SplitPolicy{MaxObjects: DefaultMaxObjectsPerBucket}); result != expected {
+			t.Errorf("Expected split policy to be unchanged but got %+v", result)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var errLinkNotSupported = errors.New("hard links are not supported by the filesystem")
+
+type bucketStorage struct {
+	rootPath        string
+	fs              FileSystem
+	dirPermissions  os.FileMode
+	filePermissions os.FileMode
+	syncMode        SyncMode
+	segmentLength   int
+
+	// beforeSave, if set, is called before buckets holding changes are
+	// saved, so that the store's key index can log the changes first.
+	beforeSave func() error
+
+	// saving is held for reading while bucket files are written or removed,
+	// and for writing by Snapshot to hold off saves while it links them.
+	saving sync.RWMutex
+}
+
+func (s *bucketStorage) AbsPath(path bucketPath) string {
+	return filepath.Join(s.rootPath, path.PathString(s.segmentLength))
+}
+
+// BeforeSave calls beforeSave, if set.
+func (s *bucketStorage) BeforeSave() error {
+	if s.beforeSave == nil {
+		return nil
+	}
+
+	return s.beforeSave()
+}
+
+func (s *bucketStorage) CreateFile(absFilePath string) (File, error) {
+	return s.fs.Create(absFilePath, s.filePermissions)
+}
+
+// Link hard links a file, if the filesystem is the operating system's.
+func (s *bucketStorage) Link(absOldPath, absNewPath string) error {
+	if s.fs != OSFileSystem {
+		return errLinkNotSupported
+	}
+
+	return os.Link(absOldPath, absNewPath)
+}
+
+func (s *bucketStorage) Mkdir(absDirPath string) error {
+	err := s.fs.Mkdir(absDirPath, s.dirPermissions)
+	if err != nil {
+		return err
+	}
+
+	return s.SyncDir(filepath.Dir(absDirPath))
+}
+
+func (s *bucketStorage) MkdirAll(absDirPath string) error {
+	fileInfo, err := s.fs.Stat(absDirPath)
+	if err == nil {
+		if !fileInfo.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", absDirPath)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	if parent := filepath.Dir(absDirPath); parent != absDirPath {
+		err = s.MkdirAll(parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.Mkdir(absDirPath)
+	if os.IsExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// MkdirTemp creates a new directory in absDirPath with a name beginning with
+// prefix, and returns its path.
+func (s *bucketStorage) MkdirTemp(absDirPath, prefix string) (string, error) {
+	for i := 0; ; i++ {
+		absTempPath := filepath.Join(absDirPath, fmt.Sprintf("%s%d-%d", prefix, time.Now().UnixNano(), i))
+
+		err := s.Mkdir(absTempPath)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return absTempPath, nil
+	}
+}
+
+func (s *bucketStorage) Open(absFilePath string) (File, error) {
+	return s.fs.Open(absFilePath)
+}
+
+func (s *bucketStorage) ReadDir(absDirPath string) ([]os.FileInfo, error) {
+	return s.fs.ReadDir(absDirPath)
+}
+
+func (s *bucketStorage) ReadFile(absFilePath string) ([]byte, error) {
+	file, err := s.fs.Open(absFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
+
+func (s *bucketStorage) Remove(absPath string) error {
+	err := s.fs.Remove(absPath)
+	if err != nil {
+		return err
+	}
+
+	return s.SyncDir(filepath.Dir(absPath))
+}
+
+func (s *bucketStorage) RemoveAll(absPath string) error {
+	if s.fs == OSFileSystem {
+		err := os.RemoveAll(absPath)
+		if err != nil {
+			return err
+		}
+
+		return s.SyncDir(filepath.Dir(absPath))
+	}
+
+	fileInfo, err := s.fs.Stat(absPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fileInfo.IsDir() {
+		entries, err := s.fs.ReadDir(absPath)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			err = s.RemoveAll(filepath.Join(absPath, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.Remove(absPath)
+}
+
+func (s *bucketStorage) Rename(absOldPath, absNewPath string) error {
+	err := s.fs.Rename(absOldPath, absNewPath)
+	if err != nil {
+		return err
+	}
+
+	err = s.SyncDir(filepath.Dir(absNewPath))
+	if err != nil {
+		return err
+	}
+
+	if filepath.Dir(absOldPath) != filepath.Dir(absNewPath) {
+		return s.SyncDir(filepath.Dir(absOldPath))
+	}
+
+	return nil
+}
+
+func (s *bucketStorage) Stat(absPath string) (os.FileInfo, error) {
+	return s.fs.Stat(absPath)
+}
+
+// SyncDir syncs the entries of a directory, if the sync mode is
+// SyncDirectories.
+func (s *bucketStorage) SyncDir(absDirPath string) error {
+	if s.syncMode != SyncDirectories {
+		return nil
+	}
+
+	dir, err := s.fs.Open(absDirPath)
+	if err != nil {
+		return err
+	}
+
+	err = dir.Sync()
+	if err != nil {
+		dir.Close()
+		return err
+	}
+
+	return dir.Close()
+}
+
+func (s *bucketStorage) SyncFile(file File) error {
+	if s.syncMode == SyncNone {
+		return nil
+	}
+
+	return file.Sync()
+}
+
+func newBucketStorage(rootPath string, o options) *bucketStorage {
+	return &bucketStorage{
+		rootPath:        rootPath,
+		fs:              o.fileSystem,
+		dirPermissions:  o.dirPermissions,
+		filePermissions: o.filePermissions,
+		syncMode:        o.syncMode,
+		segmentLength:   DefaultBucketPathSegmentLength,
+	}
+}
@@ -1,9 +1,12 @@
 package keva
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"sync"
 
@@ -13,158 +16,846 @@ import (
 const DefaultMaxObjectsPerBucket = 512
 const DefaultMaxBucketsCached = 256
 const DefaultLockPartitions = 8
+const DefaultBucketPathSegmentLength = 2
+
+// MaxBucketPathSegmentLength is the longest bucket path segment a store may
+// use, giving a fan-out of 65536 buckets per directory.
+const MaxBucketPathSegmentLength = 4
+
+// ErrClosed indicates that an operation was attempted on a store which has
+// been closed or destroyed.
+var ErrClosed = errors.New("store is closed")
+
+// ErrReadOnly indicates that an operation would modify a store which was
+// opened with OpenReadOnly.
+var ErrReadOnly = errors.New("store is read-only")
 
 type Store struct {
-	maxObjectsPerBucket int
-	rootPath            string
-	cache               *bucketCache
-	readyToFlush        bool
-	storeLock           sync.Mutex
-	bucketLock          *symlock.SymLock
+	splitPolicy   SplitPolicy
+	hashFunction  HashFunction
+	rootPath      string
+	storage       *bucketStorage
+	readOnly      bool
+	liveUpdates   bool
+	lockFile      *os.File
+	codec         Codec
+	cache         *Cache
+	readyToFlush  bool
+	storeLock     contextMutex
+	mutationLock  sync.RWMutex
+	bucketLock    *symlock.SymLock
+	digests       map[bucketPath]Digest
+	keyIndex      *keyIndex
+	manifest      storeManifest
+	namespaces    map[string]*Namespace
+	lifecycleLock sync.RWMutex
+	closed        bool
 }
 
+// Close waits for any operations in progress to finish, flushes pending
+// changes and releases the store. Every operation on the store afterwards,
+// including Close itself, returns ErrClosed.
 func (s *Store) Close() error {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
 	s.storeLock.Lock()
 	defer s.storeLock.Unlock()
 
-	return s.cache.Close(s.rootPath)
+	var keyIndexPosition int
+
+	if s.keyIndex != nil && !s.readOnly {
+		var err error
+
+		keyIndexPosition, err = s.keyIndex.Checkpoint(s.storage)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.cache.close(s.storage)
+	if err != nil {
+		return err
+	}
+
+	if s.keyIndex != nil && !s.readOnly {
+		err = s.keyIndex.Commit(s.storage, keyIndexPosition)
+		if err == nil {
+			err = s.keyIndex.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.closed = true
+
+	err = releaseProcessLock(s.lockFile)
+	s.lockFile = nil
+	return err
 }
 
+// Destroy waits for any operations in progress to finish, then discards
+// pending changes and deletes the store from disk. Every operation on the
+// store afterwards returns ErrClosed.
 func (s *Store) Destroy() error {
+	return s.destroy(false)
+}
+
+func (s *Store) Flush() error {
+	return s.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush, but gives up with the context's error if ctx is
+// done while waiting for the store, or between saving buckets. Buckets saved
+// before then remain saved, and the rest are saved by the next flush.
+func (s *Store) FlushContext(ctx context.Context) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	err = s.storeLock.LockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.storeLock.Unlock()
+
+	return s.flushLockedContext(ctx)
+}
+
+// Get decodes the value stored under the given key into dest, or returns
+// ErrValueNotFound if there is no such value. Keys beginning with a NUL
+// character are reserved, and return ErrReservedKey.
+func (s *Store) Get(key string, dest interface{}) error {
+	return s.GetContext(context.Background(), key, dest)
+}
+
+// GetContext is like Get, but gives up with the context's error if ctx is done
+// while waiting for the key's bucket to become available.
+func (s *Store) GetContext(ctx context.Context, key string, dest interface{}) error {
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	return s.getKey(ctx, key, dest)
+}
+
+// Info returns statistics about the store's use of its cache. Zero statistics
+// are returned once the store has been closed or destroyed.
+func (s *Store) Info() StoreInfo {
+	if s.beginOperation() != nil {
+		return StoreInfo{}
+	}
+	defer s.endOperation()
+
+	hitCount, missCount := s.cache.info(s.storage)
+
+	return StoreInfo{
+		CacheHitCount:  hitCount,
+		CacheMissCount: missCount,
+	}
+}
+
+// Put stores a value under the given key, replacing any existing value. Keys
+// beginning with a NUL character are reserved, and return ErrReservedKey.
+func (s *Store) Put(key string, value interface{}) error {
+	return s.PutContext(context.Background(), key, value)
+}
+
+// PutContext is like Put, but gives up with the context's error if ctx is done
+// while waiting for the key's bucket to become available. Once the value has
+// been stored, any resulting split runs to completion regardless of ctx.
+func (s *Store) PutContext(ctx context.Context, key string, value interface{}) error {
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	encodedValue, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return s.putEncoded(ctx, key, encodedValue)
+}
+
+// Remove removes the value stored under the given key, if any. Keys beginning
+// with a NUL character are reserved, and return ErrReservedKey.
+func (s *Store) Remove(key string) error {
+	return s.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is like Remove, but gives up with the context's error if ctx
+// is done while waiting for the key's bucket to become available.
+func (s *Store) RemoveContext(ctx context.Context, key string) error {
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	return s.removeKey(ctx, key)
+}
+
+// SetMaxBucketsCached flushes the store and changes the number of buckets its
+// cache holds. If the cache is shared with other stores, they are flushed and
+// affected too.
+func (s *Store) SetMaxBucketsCached(n int) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
 	s.storeLock.Lock()
 	defer s.storeLock.Unlock()
 
-	s.cache.Clear()
-	return os.RemoveAll(s.rootPath)
+	return s.cache.SetMaxBuckets(n)
 }
 
-func (s *Store) Flush() error {
+// SetMaxObjectsPerBucket sets the number of objects a bucket may hold before
+// it is split, leaving any limit on the size of buckets in place. The setting
+// is recorded in the store's manifest and persists across reopens; it affects
+// only future splits.
+func (s *Store) SetMaxObjectsPerBucket(n int) error {
+	if n < 1 {
+		return fmt.Errorf("%w: max objects per bucket must be positive", ErrInvalidSplitPolicy)
+	}
+
+	return s.updateSplitPolicy(func(p SplitPolicy) SplitPolicy {
+		p.MaxObjects = n
+		return p
+	})
+}
+
+// SetSplitPolicy sets when buckets are split. The policy is recorded in the
+// store's manifest and persists across reopens; it affects only future
+// splits.
+func (s *Store) SetSplitPolicy(p SplitPolicy) error {
+	return s.updateSplitPolicy(func(SplitPolicy) SplitPolicy {
+		return p
+	})
+}
+
+// SplitPolicy returns the store's current split policy.
+func (s *Store) SplitPolicy() SplitPolicy {
 	s.storeLock.Lock()
 	defer s.storeLock.Unlock()
 
-	if s.readyToFlush {
-		err := s.cache.Flush(s.rootPath)
-		if err != nil {
-			return err
-		}
+	return s.splitPolicy
+}
 
-		s.readyToFlush = false
+// beginOperation marks the start of an operation, which Close and Destroy will
+// wait for. It returns ErrClosed if the store has already been closed, in which
+// case endOperation must not be called.
+func (s *Store) beginOperation() error {
+	s.lifecycleLock.RLock()
+
+	if s.closed {
+		s.lifecycleLock.RUnlock()
+		return ErrClosed
 	}
 
 	return nil
 }
 
-func (s *Store) Get(key string, dest interface{}) error {
-	return s.withBucketForKey(key, func(bucket *bucket) error {
-		return bucket.Get(key, dest)
-	})
+func (s *Store) bucketForKey(key string) (*bucket, error) {
+	return s.bucketForID(s.bucketIDForKey(key))
 }
 
-func (s *Store) Info() StoreInfo {
-	return StoreInfo{
-		CacheHitCount:  s.cache.HitCount,
-		CacheMissCount: s.cache.MissCount,
+func (s *Store) bucketForID(id string) (*bucket, error) {
+	return s.bucketForIDContext(context.Background(), id)
+}
+
+func (s *Store) bucketForIDContext(ctx context.Context, id string) (*bucket, error) {
+	err := s.storeLock.LockContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.storeLock.Unlock()
+
+	b, err := s.cache.fetch(id, s.storage, s.loadBucketForID)
+	if err != nil || !s.liveUpdates {
+		return b, err
+	}
+
+	stale, err := b.IsStale(s.storage)
+	if err != nil || !stale {
+		return b, err
 	}
+
+	err = s.cache.evict(id, s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.cache.fetch(id, s.storage, s.loadBucketForID)
 }
 
-func (s *Store) Put(key string, value interface{}) error {
-	id := s.bucketIDForKey(key)
+func (s *Store) bucketIDForKey(key string) string {
+	return s.hashFunction.bucketID(key)
+}
+
+// destroy is like Destroy, but if keepRoot is set, leaves the store's root
+// directory in place and removes only its contents.
+func (s *Store) destroy(keepRoot bool) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	s.cache.discard(s.storage)
+	s.digests = make(map[bucketPath]Digest)
+	s.closed = true
+
+	if s.keyIndex != nil {
+		s.keyIndex.Close()
+	}
+
+	releaseProcessLock(s.lockFile)
+	s.lockFile = nil
 
-	return s.withBucketForID(id, func(bucket *bucket) error {
-		err := bucket.Put(key, value)
+	if !keepRoot {
+		return s.storage.RemoveAll(s.rootPath)
+	}
+
+	entries, err := s.storage.ReadDir(s.rootPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = s.storage.RemoveAll(filepath.Join(s.rootPath, entry.Name()))
 		if err != nil {
 			return err
 		}
+	}
 
-		s.readyToFlush = true
+	return nil
+}
+
+func (s *Store) endOperation() {
+	s.lifecycleLock.RUnlock()
+}
+
+func (s *Store) flushLocked() error {
+	return s.flushLockedContext(context.Background())
+}
+
+func (s *Store) flushLockedContext(ctx context.Context) error {
+	if s.readyToFlush {
+		var keyIndexPosition int
+
+		if s.keyIndex != nil {
+			var err error
+
+			keyIndexPosition, err = s.keyIndex.Checkpoint(s.storage)
+			if err != nil {
+				return err
+			}
+		}
 
-		if bucket.ObjectCount() > s.maxObjectsPerBucket {
-			s.storeLock.Lock()
-			err = s.cache.Evict(id, s.rootPath)
-			s.storeLock.Unlock()
+		err := s.cache.flush(ctx, s.storage)
+		if err != nil {
+			return err
+		}
 
+		if s.keyIndex != nil {
+			err = s.keyIndex.Commit(s.storage, keyIndexPosition)
 			if err != nil {
 				return err
 			}
+		}
+
+		s.readyToFlush = false
+	}
+
+	return nil
+}
+
+func (s *Store) getEncoded(ctx context.Context, key string) (encodedValue []byte, err error) {
+	err = s.beginOperation()
+	if err != nil {
+		return
+	}
+	defer s.endOperation()
+
+	err = s.withBucketForKey(ctx, key, func(bucket *bucket) error {
+		var ok bool
 
-			return bucket.Split(s.rootPath, s.bucketForKey)
+		encodedValue, ok = bucket.objects[key]
+		if !ok {
+			return ErrValueNotFound
 		}
 
 		return nil
 	})
+
+	return
 }
 
-func (s *Store) Remove(key string) error {
-	return s.withBucketForKey(key, func(bucket *bucket) error {
-		bucket.Remove(key)
-		s.readyToFlush = true
-		return nil
+func (s *Store) getKey(ctx context.Context, key string, dest interface{}) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	return s.withBucketForKey(ctx, key, func(bucket *bucket) error {
+		return bucket.Get(key, dest, s.codec)
 	})
 }
 
-func (s *Store) SetMaxBucketsCached(n int) error {
+func (s *Store) invalidateDigests(path bucketPath) {
 	s.storeLock.Lock()
 	defer s.storeLock.Unlock()
 
-	return s.cache.SetMaxBucketsCached(n, s.rootPath)
+	for {
+		delete(s.digests, path)
+
+		if path == "" {
+			break
+		}
+		path = path.Parent(s.storage.segmentLength)
+	}
 }
 
-func (s *Store) SetMaxObjectsPerBucket(n int) {
-	s.maxObjectsPerBucket = n
+func (s *Store) loadBucketForID(id string) (*bucket, error) {
+	var b bucket
+	err := b.Load(s.storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
 }
 
-func (s *Store) bucketForKey(key string) (*bucket, error) {
-	return s.bucketForID(s.bucketIDForKey(key))
+// markChanged records that the bucket at path has been modified, so the store
+// needs flushing and the digests of the path and its ancestors are stale.
+func (s *Store) markChanged(path bucketPath) {
+	s.storeLock.Lock()
+	s.readyToFlush = true
+	s.storeLock.Unlock()
+
+	s.invalidateDigests(path)
 }
 
-func (s *Store) bucketForID(id string) (*bucket, error) {
+// needsSplit indicates whether bucket exceeds the store's split policy.
+func (s *Store) needsSplit(bucket *bucket) bool {
 	s.storeLock.Lock()
-	defer s.storeLock.Unlock()
+	policy := s.splitPolicy
+	s.storeLock.Unlock()
+
+	// Buckets whose paths are already whole IDs can't be split any further.
 
-	return s.cache.Fetch(id, s.rootPath, s.loadBucketForID)
+	return policy.exceeded(bucket.ObjectCount(), bucket.Size()) && len(bucket.path) < len(bucket.id)
 }
 
-func (s *Store) bucketIDForKey(key string) string {
-	hash := sha256.Sum256([]byte(key))
-	return hex.EncodeToString(hash[:])
+// pruneEmptyBucket saves an emptied bucket, removing its file, and removes
+// any directories left empty above it. It must be called with the lock for
+// the bucket's partition held, so that no other buckets beneath those
+// directories can be fetched meanwhile.
+//
+// A directory is left in place while any buckets beneath it are cached, as
+// they would otherwise be saved into a directory which no longer exists.
+// Directories left empty this way are merged away by Compact.
+func (s *Store) pruneEmptyBucket(b *bucket) error {
+	if b.path.Parent(s.storage.segmentLength) == "" {
+		return nil
+	}
+
+	s.storeLock.Lock()
+	err := s.cache.evict(b.id, s.storage)
+	s.storeLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = b.Save(s.storage)
+	if err != nil {
+		return err
+	}
+
+	for path := b.path.Parent(s.storage.segmentLength); path != ""; path = path.Parent(s.storage.segmentLength) {
+		if s.cache.holdsUnder(path, s.storage) {
+			return nil
+		}
+
+		absDirPath := s.storage.AbsPath(path)
+
+		s.storage.saving.RLock()
+		entries, err := s.storage.ReadDir(absDirPath)
+		if err == nil && len(entries) == 0 {
+			err = s.storage.Remove(absDirPath)
+		}
+		s.storage.saving.RUnlock()
+
+		if err != nil || len(entries) > 0 {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (s *Store) loadBucketForID(id string) (*bucket, error) {
-	var b bucket
-	err := b.Load(s.rootPath, id)
+func (s *Store) putEncoded(ctx context.Context, key string, encodedValue []byte) error {
+	err := s.beginOperation()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer s.endOperation()
 
-	return &b, nil
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mutationLock.RLock()
+	defer s.mutationLock.RUnlock()
+
+	id := s.bucketIDForKey(key)
+
+	return s.withBucketForID(ctx, id, func(bucket *bucket) error {
+		s.changeKey(bucket, key, true, func() {
+			bucket.PutEncoded(key, encodedValue)
+		})
+
+		defer s.markChanged(bucket.path)
+
+		return s.splitIfNeeded(id, bucket)
+	})
+}
+
+func (s *Store) removeKey(ctx context.Context, key string) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mutationLock.RLock()
+	defer s.mutationLock.RUnlock()
+
+	return s.withBucketForKey(ctx, key, func(bucket *bucket) error {
+		s.changeKey(bucket, key, false, func() {
+			bucket.Remove(key)
+		})
+
+		s.markChanged(bucket.path)
+
+		if bucket.ObjectCount() == 0 {
+			return s.pruneEmptyBucket(bucket)
+		}
+
+		return nil
+	})
+}
+
+func (s *Store) saveIfEvicted(b *bucket) error {
+	if s.cache.holds(b, s.storage) {
+		return nil
+	}
+
+	return b.Save(s.storage)
+}
+
+func (s *Store) splitIfNeeded(id string, bucket *bucket) error {
+	if !s.needsSplit(bucket) {
+		return nil
+	}
+
+	s.storeLock.Lock()
+	err := s.cache.evict(id, s.storage)
+	s.storeLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = bucket.Split(s.storage, s.bucketIDForKey)
+	if err != nil {
+		return err
+	}
+
+	// Keys which all hashed to the same child may have left it oversized too.
+
+	for key := range bucket.objects {
+		childID := s.bucketIDForKey(key)
+
+		child, err := s.bucketForID(childID)
+		if err != nil {
+			return err
+		}
+
+		err = s.splitIfNeeded(childID, child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateSplitPolicy replaces the store's split policy with the one returned by
+// update, and records it in the manifest.
+func (s *Store) updateSplitPolicy(update func(SplitPolicy) SplitPolicy) error {
+	err := s.beginOperation()
+	if err != nil {
+		return err
+	}
+	defer s.endOperation()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+
+	policy := update(s.splitPolicy)
+
+	err = policy.Validate()
+	if err != nil {
+		return err
+	}
+
+	manifest := s.manifest
+	manifest.setSplitPolicy(policy)
+
+	err = manifest.Save(s.storage)
+	if err != nil {
+		return err
+	}
+
+	s.manifest = manifest
+	s.splitPolicy = policy
+	return nil
 }
 
-func (s *Store) withBucketForID(id string, action func(*bucket) error) (err error) {
-	s.bucketLock.WithMutex(id[0:bucketPathSegmentLength], func() {
+func (s *Store) withBucketForID(ctx context.Context, id string, action func(*bucket) error) (err error) {
+	lockErr := withSymbolLock(ctx, s.bucketLock, id[0:s.storage.segmentLength], func() {
 		var bucket *bucket
-		bucket, err = s.bucketForID(id)
-		if err == nil {
-			err = action(bucket)
+		bucket, err = s.bucketForIDContext(ctx, id)
+		if err != nil {
+			return
+		}
+
+		err = action(bucket)
+
+		// Fetching other buckets concurrently may have evicted this one
+		// before action modified it, in which case it must be saved here
+		// or the change would be lost.
+
+		if saveErr := s.saveIfEvicted(bucket); err == nil {
+			err = saveErr
 		}
 	})
+	if lockErr != nil {
+		return lockErr
+	}
 
 	return
 }
 
-func (s *Store) withBucketForKey(key string, action func(*bucket) error) error {
-	return s.withBucketForID(s.bucketIDForKey(key), action)
+func (s *Store) withBucketForKey(ctx context.Context, key string, action func(*bucket) error) error {
+	return s.withBucketForID(ctx, s.bucketIDForKey(key), action)
+}
+
+func isReservedKey(key string) bool {
+	return strings.HasPrefix(key, namespaceKeyPrefix)
 }
 
-func NewStore(rootPath string) (*Store, error) {
-	err := os.MkdirAll(rootPath, 0700)
+// NewStore opens the store at rootPath, creating it if it does not exist,
+// configured by any given options. An error wrapping ErrInvalidOption is
+// returned if any option value cannot be used.
+//
+// A manifest recording the store's format and layout is written when a store
+// is created, and validated when an existing one is opened. An error wrapping
+// ErrIncompatibleStore is returned if the store cannot be read by this
+// version of the package or with the given options. Layout options apply only
+// to new stores; an existing store written before manifests were introduced
+// is recorded as having the default layout.
+//
+// The store is locked against being opened by other processes until it is
+// closed, and ErrStoreLocked is returned if it is already open elsewhere.
+// Bucket splits and merges interrupted by a crash are completed when the store
+// is opened, and snapshots left by interrupted backups are removed.
+func NewStore(rootPath string, opts ...Option) (*Store, error) {
+	o := newOptions(opts)
+
+	err := o.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	storage := newBucketStorage(rootPath, o)
+
+	err = storage.MkdirAll(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lockFile, err := acquireProcessLock(storage, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recoverLayout(storage, rootPath)
+	if err == nil {
+		err = removeBackupSnapshots(storage, rootPath)
+	}
 	if err != nil {
+		releaseProcessLock(lockFile)
 		return nil, err
 	}
 
+	var manifest storeManifest
+
+	err = manifest.Load(storage)
+	if os.IsNotExist(err) {
+		manifest, err = initStoreManifest(o, storage)
+		if err == nil {
+			err = manifest.Save(storage)
+		}
+	} else if err == nil {
+		err = manifest.Reconcile(o, storage)
+	}
+	if err != nil {
+		releaseProcessLock(lockFile)
+		return nil, err
+	}
+
+	s := newStore(storage, manifest, o, lockFile, false)
+
+	if manifest.KeyIndex {
+		s.keyIndex, err = openKeyIndex(storage, false, s.hasKey)
+		if err != nil {
+			s.cache.discard(storage)
+			releaseProcessLock(lockFile)
+			return nil, err
+		}
+
+		storage.beforeSave = func() error {
+			return s.keyIndex.WritePending(storage)
+		}
+	}
+
+	return s, nil
+}
+
+// OpenReadOnly opens an existing store at rootPath without ever writing to
+// it. Put, Remove, Flush and other operations which would modify the store
+// return ErrReadOnly.
+//
+// No directories, temporary files or manifests are created, so a store may
+// safely be opened from a read-only filesystem or mounted snapshot. Options
+// which would be persisted, such as WithMaxObjectsPerBucket, are validated as
+// by NewStore but otherwise ignored. Nor are interrupted bucket splits
+// completed, so objects in buckets which were being split when a writer
+// crashed are missing until the store is next opened with NewStore.
+//
+// A shared lock is taken on the store, so any number of read-only opens may
+// coexist but ErrStoreLocked is returned if a writer has the store open. Use
+// WithLiveUpdates to read a store while another process writes to it.
+//
+// A store's key index is loaded if it was saved, and otherwise rebuilt in
+// memory. Changes made by a writer are not reflected in the index of a store
+// opened WithLiveUpdates.
+func OpenReadOnly(rootPath string, opts ...Option) (*Store, error) {
+	o := newOptions(opts)
+
+	err := o.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	storage := newBucketStorage(rootPath, o)
+
+	fileInfo, err := storage.Stat(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if !fileInfo.IsDir() {
+		return nil, fmt.Errorf("store location '%s' is not a directory", rootPath)
+	}
+
+	var lockFile *os.File
+
+	if !o.liveUpdates {
+		lockFile, err = acquireProcessLock(storage, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var manifest storeManifest
+
+	err = manifest.Load(storage)
+	if os.IsNotExist(err) {
+		manifest, err = initStoreManifest(o, storage)
+	} else if err == nil {
+		err = manifest.CheckOptions(o)
+	}
+	if err != nil {
+		releaseProcessLock(lockFile)
+		return nil, err
+	}
+
+	s := newStore(storage, manifest, o, lockFile, true)
+
+	if manifest.KeyIndex {
+		s.keyIndex, err = openKeyIndex(storage, true, s.hasKey)
+		if err != nil {
+			s.cache.discard(storage)
+			releaseProcessLock(lockFile)
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func newStore(storage *bucketStorage, manifest storeManifest, o options, lockFile *os.File, readOnly bool) *Store {
+	cache := o.cache
+	if cache == nil {
+		cache = &Cache{buckets: newBucketCache(o.maxBucketsCached)}
+	}
+
+	storage.segmentLength = manifest.BucketPathSegmentLength
+
 	return &Store{
-		maxObjectsPerBucket: DefaultMaxObjectsPerBucket,
-		rootPath:            rootPath,
-		cache:               newBucketCache(DefaultMaxBucketsCached),
-		bucketLock:          symlock.NewWithPartitions(DefaultLockPartitions),
-	}, nil
+		splitPolicy:  manifest.splitPolicy(),
+		hashFunction: manifest.HashFunction,
+		manifest:     manifest,
+		rootPath:     storage.rootPath,
+		storage:      storage,
+		readOnly:     readOnly,
+		liveUpdates:  readOnly && o.liveUpdates,
+		lockFile:     lockFile,
+		codec:        o.codec,
+		cache:        cache,
+		bucketLock:   symlock.NewWithPartitions(o.lockPartitions),
+		digests:      make(map[bucketPath]Digest),
+		namespaces:   make(map[string]*Namespace),
+	}
 }
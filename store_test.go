@@ -162,4 +162,63 @@ func TestStore(t *testing.T) {
 			t.Fatalf("Expected value to have been removed but got error: %v", err)
 		}
 	})
+
+	t.Run("Remove() deletes emptied buckets and prunes empty directories", func(t *testing.T) {
+		rootPath, err := ioutil.TempDir("", "keva-test")
+		if err != nil {
+			t.Fatalf("Could not create temporary location for store: %v", err)
+		}
+
+		s, err := NewStore(rootPath, WithMaxObjectsPerBucket(1))
+		if err != nil {
+			t.Fatalf("Could not create store: %v", err)
+		}
+		defer s.Destroy()
+
+		for i := 0; i < 100; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		for i := 0; i < 100; i++ {
+			err = s.Remove(fmt.Sprintf("key%d", i))
+			if err != nil {
+				t.Fatalf("Error when removing value: %v", err)
+			}
+		}
+
+		err = s.Flush()
+		if err != nil {
+			t.Fatalf("Error when flushing store: %v", err)
+		}
+
+		names, err := bucketNames(s.storage, rootPath)
+		if err != nil {
+			t.Fatalf("Error reading store: %v", err)
+		}
+		if len(names) != 0 {
+			t.Errorf("Expected no buckets to remain but found %v", names)
+		}
+
+		for i := 0; i < 100; i++ {
+			err = s.Put(fmt.Sprintf("key%d", i), i)
+			if err != nil {
+				t.Fatalf("Error when storing value: %v", err)
+			}
+		}
+
+		for i := 0; i < 100; i++ {
+			var result int
+
+			err := s.Get(fmt.Sprintf("key%d", i), &result)
+			if err != nil {
+				t.Fatalf("Error when retrieving value %d: %v", i, err)
+			}
+			if result != i {
+				t.Errorf("Expected %d but got %d", i, result)
+			}
+		}
+	})
 }
@@ -0,0 +1,110 @@
+package keva
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTypeMismatch indicates that a stored value could not be decoded as the
+// type expected by a TypedStore.
+var ErrTypeMismatch = errors.New("stored value does not match type")
+
+// TypedStore wraps a Store whose values are all of type T, so that callers
+// don't need to pass destinations or make type assertions.
+//
+// Values are decoded directly into a T. If the store's codec implements
+// StrictCodec, values are decoded strictly so that values of some other type
+// are reported as ErrTypeMismatch rather than partially decoded.
+type TypedStore[T any] struct {
+	store *Store
+}
+
+// Get returns the value for the given key, or ErrValueNotFound if there is no
+// such value. An error wrapping ErrTypeMismatch is returned if the value
+// cannot be decoded as a T.
+func (ts *TypedStore[T]) Get(key string) (T, error) {
+	return ts.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but gives up with the context's error if ctx is done
+// while waiting for the key's bucket to become available.
+func (ts *TypedStore[T]) GetContext(ctx context.Context, key string) (T, error) {
+	var value T
+
+	if isReservedKey(key) {
+		return value, ErrReservedKey
+	}
+
+	encodedValue, err := ts.store.getEncoded(ctx, key)
+	if err != nil {
+		return value, err
+	}
+
+	err = ts.decode(encodedValue, &value)
+	return value, err
+}
+
+// ForEach calls action with every key and value in the store. Pending changes
+// are flushed first and writes are held off until iteration completes, so
+// action must not modify the store. Iteration stops at the first error
+// returned by action or encountered while decoding. Keys belonging to
+// namespaces are not included.
+func (ts *TypedStore[T]) ForEach(action func(key string, value T) error) error {
+	return ts.store.forEachObject(func(key string, encodedValue []byte) error {
+		if isReservedKey(key) {
+			return nil
+		}
+
+		var value T
+
+		err := ts.decode(encodedValue, &value)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", key, err)
+		}
+
+		return action(key, value)
+	})
+}
+
+// Put stores a value under the given key.
+func (ts *TypedStore[T]) Put(key string, value T) error {
+	return ts.store.Put(key, value)
+}
+
+// PutContext is like Put, but gives up with the context's error if ctx is
+// done while waiting for the key's bucket to become available.
+func (ts *TypedStore[T]) PutContext(ctx context.Context, key string, value T) error {
+	return ts.store.PutContext(ctx, key, value)
+}
+
+// Remove removes the value for the given key.
+func (ts *TypedStore[T]) Remove(key string) error {
+	return ts.store.Remove(key)
+}
+
+// Store returns the underlying store.
+func (ts *TypedStore[T]) Store() *Store {
+	return ts.store
+}
+
+func (ts *TypedStore[T]) decode(encodedValue []byte, dest *T) error {
+	var err error
+
+	if strictCodec, ok := ts.store.codec.(StrictCodec); ok {
+		err = strictCodec.UnmarshalStrict(encodedValue, dest)
+	} else {
+		err = ts.store.codec.Unmarshal(encodedValue, dest)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTypeMismatch, err)
+	}
+
+	return nil
+}
+
+// NewTypedStore returns a TypedStore holding values of type T in s.
+func NewTypedStore[T any](s *Store) *TypedStore[T] {
+	return &TypedStore[T]{store: s}
+}
@@ -0,0 +1,110 @@
+package keva
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTypedStore(t *testing.T) {
+
+	t.Run("Put() and Get() can be roundtripped", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		ts := NewTypedStore[testValue](s)
+
+		value := testValue{Name: "apple", Colour: "red"}
+
+		err := ts.Put("abc123", value)
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+
+		result, err := ts.Get("abc123")
+		if err != nil {
+			t.Fatalf("Error when retrieving value: %v", err)
+		}
+		if result != value {
+			t.Errorf("Expected %v but got %v", value, result)
+		}
+
+		_, err = ts.Get("missing")
+		if err != ErrValueNotFound {
+			t.Errorf("Expected ErrValueNotFound but got %v", err)
+		}
+	})
+
+	t.Run("Get() reports values of another type as ErrTypeMismatch", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		s.Put("number", 42)
+		s.Put("other", map[string]string{"name": "apple", "weight": "100g"})
+
+		ts := NewTypedStore[testValue](s)
+
+		_, err := ts.Get("number")
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("Expected ErrTypeMismatch but got %v", err)
+		}
+
+		_, err = ts.Get("other")
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("Expected ErrTypeMismatch but got %v", err)
+		}
+	})
+
+	t.Run("Get() rejects keys reserved for namespaces", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		fruit, err := s.Namespace("fruit")
+		if err != nil {
+			t.Fatalf("Error when obtaining namespace: %v", err)
+		}
+
+		err = fruit.Put("abc123", testValue{Name: "apple", Colour: "red"})
+		if err != nil {
+			t.Fatalf("Error when storing value: %v", err)
+		}
+
+		ts := NewTypedStore[testValue](s)
+
+		_, err = ts.Get(namespaceKeyPrefix + "fruit" + namespaceKeyPrefix + "abc123")
+		if err != ErrReservedKey {
+			t.Errorf("Expected ErrReservedKey but got %v", err)
+		}
+	})
+
+	t.Run("ForEach() visits every value", func(t *testing.T) {
+		s := newTempStore(t)
+		defer s.Destroy()
+
+		ts := NewTypedStore[int](s)
+
+		for i := 0; i < 100; i++ {
+			ts.Put(fmt.Sprintf("key%d", i), i)
+		}
+
+		sum := 0
+		count := 0
+
+		err := ts.ForEach(func(key string, value int) error {
+			if expected := fmt.Sprintf("key%d", value); key != expected {
+				t.Errorf("Expected key '%s' but got '%s'", expected, key)
+			}
+
+			sum += value
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error iterating: %v", err)
+		}
+
+		if count != 100 || sum != 4950 {
+			t.Errorf("Expected 100 values summing to 4950 but got %d summing to %d", count, sum)
+		}
+	})
+}